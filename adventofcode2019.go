@@ -19,19 +19,27 @@ import (
 	"adventofcode2019/day15"
 	"adventofcode2019/day16"
 	"adventofcode2019/day17"
+	"adventofcode2019/intcode"
+	"errors"
 	"flag"
 	"fmt"
+	"runtime"
 )
 
 func main() {
 
 	// specific for day02
 	objptr := flag.Int("objective", 19690720, "objective to get")
+	symbolicptr := flag.Bool("symbolic", false, "find the noun and the verb by symbolic execution instead of trying every pair")
 
 	// specific for day04
 	startptr := flag.Int("start", 123257, "start of day04 range")
 	endptr := flag.Int("end", 647015, "end of day04 range")
 
+	// specific for day07
+	topologyptr := flag.String("topology", "", "file describing the wiring of amplifiers (part 2 loop if empty)")
+	workersptr := flag.Int("workers", runtime.NumCPU(), "number of phase settings tried in parallel, 1 when intcode tools are used")
+
 	// specific for day08
 	widthptr := flag.Int("width", 25, "width of layer")
 	heightptr := flag.Int("height", 6, "height of layer")
@@ -40,80 +48,194 @@ func main() {
 	stepsptr := flag.Int("steps", 10, "nb of steps")
 	intervalptr := flag.Int("interval", 1, "describe state every X step")
 
+	// specific for intcode tooling (day 0)
+	disasmptr := flag.Bool("disasm", false, "print the annotated listing of the intcode program")
+	asmptr := flag.Bool("asm", false, "assemble the intcode assembly source into a program")
+	debugptr := flag.Bool("debug", false, "run the intcode programs in the interactive debugger, the day drives them unless it is day 0")
+	cfgptr := flag.String("cfg", "", "file to write the control-flow graph of the intcode program to")
+	cfgformatptr := flag.String("cfgformat", "dot", "format of the control-flow graph: dot or json")
+	transpileptr := flag.String("transpile", "", "file to write the Go translation of the intcode program to")
+	transpilepkgptr := flag.String("transpilepkg", "main", "package of the Go translation")
+	replayptr := flag.Bool("replay", false, "replay the intcode recording and check the outputs are the same")
+	solveptr := flag.String("solve", "", "goal to solve the intcode program for, like mem[0]=19690720, out=42 or out[0]=42")
+	symbolsptr := flag.String("symbols", "", "memory cells solved by -solve, with their range, like 1=0..99,2=0..99")
+	inputsptr := flag.String("inputs", "", "range of the inputs solved by -solve, like 0..99")
+
+	// intcode tracing, works for every day using the intcode package
+	traceptr := flag.String("trace", "", "file to write the execution trace of intcode programs to")
+	traceformatptr := flag.String("traceformat", "json", "format of the trace: json or binary")
+	tracemaxptr := flag.Int("tracemax", 0, "maximum number of trace entries per program (0 for no limit)")
+	traceopsptr := flag.String("traceops", "", "comma-separated opcodes to trace (empty for all)")
+	traceipsptr := flag.String("traceips", "", "range of instruction addresses to trace, like 100-200")
+	toolfilesptr := flag.Int("toolfiles", 100, "maximum number of files written by intcode tools, one per program (0 for no limit)")
+
+	// intcode profiling, works for every day using the intcode package
+	profileptr := flag.String("profile", "", "file to write the execution profile of intcode programs to")
+	profileformatptr := flag.String("profileformat", "text", "format of the profile: text or pprof")
+	profiletopptr := flag.Int("profiletop", 20, "number of hot spots listed by the text profile")
+
+	// intcode recording, works for every day using the intcode package
+	recordptr := flag.String("record", "", "file to record the inputs and outputs of intcode programs to")
+
+	// intcode heat map, works for every day using the intcode package
+	heatmapptr := flag.String("heatmap", "", "file to write the PNG memory heat map of intcode programs to")
+	heatmapliveptr := flag.Int("heatmaplive", 0, "redraw the memory heat map in the terminal every N instructions (0 for never)")
+	heatmapwidthptr := flag.Int("heatmapwidth", 64, "number of memory cells by row of the heat map")
+	heatmapscaleptr := flag.Int("heatmapscale", 8, "pixels by memory cell of the PNG heat map")
+
+	// intcode debugging with an editor, works for every day using the intcode package
+	dapptr := flag.String("dap", "", "serve a Debug Adapter Protocol client on a TCP address like localhost:4711, or on stdio")
+
+	// intcode arithmetic, works for every day using the intcode package
+	arithmeticptr := flag.String("arithmetic", "wrapping", "arithmetic of intcode programs: wrapping, checked or big")
+
 	// common flags
 	fptr := flag.String("file", "input.txt", "file path to read from")
 	dayptr := flag.Int("day", 17, "run the solution for day XX")
 	flag.Parse()
 
+	if *arithmeticptr != "wrapping" {
+		checkError(setArithmetic(*arithmeticptr))
+	}
+
+	if *traceptr != "" {
+		flush, err := traceIntcode(*traceptr, *traceformatptr, *tracemaxptr, *traceopsptr, *traceipsptr, *toolfilesptr)
+		checkError(err)
+		addToolFlush(flush)
+	}
+
+	if *profileptr != "" {
+		flush, err := profileIntcode(*profileptr, *profileformatptr, *profiletopptr)
+		checkError(err)
+		addToolFlush(flush)
+	}
+
+	if *heatmapptr != "" || *heatmapliveptr > 0 {
+		writeHeatmaps := heatmapIntcode(*heatmapptr, *heatmapliveptr, *heatmapwidthptr, *heatmapscaleptr, *toolfilesptr)
+		addToolFlush(writeHeatmaps)
+	}
+
+	if *debugptr && *dayptr != 0 {
+		if *dapptr != "" {
+			checkError(errors.New("-debug and -dap can't be used together"))
+		}
+		debugAttached()
+	}
+
+	if *dapptr != "" {
+		closeSession, err := debugIntcode(*dapptr)
+		checkError(err)
+		addToolFlush(closeSession)
+	}
+
+	if *recordptr != "" {
+		closeRecordings := recordIntcode(*recordptr, *toolfilesptr)
+		addToolFlush(closeRecordings)
+	}
+
 	switch *dayptr {
+	case 0:
+		switch {
+		case *disasmptr:
+			err := disassemble(*fptr)
+			checkError(err)
+		case *asmptr:
+			err := assemble(*fptr)
+			checkError(err)
+		case *debugptr:
+			err := debug(*fptr)
+			checkError(err)
+		case *cfgptr != "":
+			err := writeCFG(*fptr, *cfgptr, *cfgformatptr)
+			checkError(err)
+		case *transpileptr != "":
+			err := transpile(*fptr, *transpileptr, *transpilepkgptr)
+			checkError(err)
+		case *replayptr:
+			err := replay(*fptr)
+			checkError(err)
+		case *solveptr != "":
+			err := solve(*fptr, *solveptr, *symbolsptr, *inputsptr)
+			checkError(err)
+		default:
+			checkError(errors.New("day 0 needs an intcode tool flag like -disasm, -asm, -debug, -transpile, -replay or -solve"))
+		}
 	case 1:
 		result, err := day01.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 2:
-		result, err := day02.Run(*objptr, *fptr)
-		common.CheckError(err)
+		result, err := day02.Run(*objptr, *fptr, *symbolicptr)
+		checkError(err)
 		shareResult(result)
 	case 3:
 		result, err := day03.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 4:
 		result := day04.Run(*startptr, *endptr)
 		shareResult(result)
 	case 5:
 		result, err := day05.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 6:
 		result, err := day06.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 7:
-		result, err := day07.Run(*fptr)
-		common.CheckError(err)
+		workers := *workersptr
+		if intcode.Instrumented() {
+			// tools like tracers name their files in the order programs are created
+			workers = 1
+		}
+		result, err := day07.Run(*fptr, *topologyptr, workers)
+		checkError(err)
 		shareResult(result)
 	case 8:
 		result, err := day08.Run(*fptr, *widthptr, *heightptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 9:
 		result, err := day09.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 10:
 		x, y, err := day10.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		fmt.Printf("Coordinates: %v, %v\n", x, y)
 	case 11:
 		result, err := day11.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 12:
 		result, err := day12.Run(*fptr, *stepsptr, *intervalptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 13:
 		result, err := day13.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 14:
 		result, err := day14.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 15:
 		result, err := day15.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 16:
 		result, err := day16.Run(*fptr, *stepsptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	case 17:
 		result, err := day17.Run(*fptr)
-		common.CheckError(err)
+		checkError(err)
 		shareResult(result)
 	}
+
+	// the tools are flushed by checkError when a day fails
+	common.CheckError(flushTools())
 }
 
 func shareResult(result interface{}) {
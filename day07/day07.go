@@ -1,274 +1,151 @@
 package day07
 
 import (
-	"adventofcode2019/common"
-	"bufio"
+	"adventofcode2019/intcode"
 	"errors"
-	"strconv"
+	"fmt"
 	"strings"
+	"sync"
 
 	"gonum.org/v1/gonum/stat/combin"
 )
 
 // Run is the entrypoint of day07 exercice
-func Run(filepath string) (int, error) {
-
-	f := common.OpenFile(filepath)
-	defer common.CloseFile(f)
-
-	s := bufio.NewScanner(f)
-	s.Scan()
-
-	parts := strings.Split(s.Text(), ",")
-	err := s.Err()
+// topologyPath describes the wiring of amplifiers, the part 2 loop if empty
+// workers is the number of phase settings tried in parallel
+func Run(filepath, topologyPath string, workers int) (int, error) {
+	seq, err := intcode.ReadProgram(filepath)
 	if err != nil {
 		return 0, err
 	}
 
-	seq := make([]int, 0)
-	for _, elt := range parts {
-		code, err := strconv.Atoi(elt)
-		if err != nil {
-			return 0, err
-		}
-
-		seq = append(seq, code)
+	var topology *Topology
+	if topologyPath == "" {
+		topology, err = ParseTopology(strings.NewReader(defaultTopology))
+	} else {
+		topology, err = ReadTopology(topologyPath)
 	}
-	createProgram := programCreator(seq)
-
-	result := -1
-
-	gen := combin.NewPermutationGenerator(5, 5)
-	for gen.Next() {
-		perm := gen.Permutation(nil)
-
-		amplifiers := []*IntCodeProgram{
-			createProgram("A", perm[0]+5),
-			createProgram("B", perm[1]+5),
-			createProgram("C", perm[2]+5),
-			createProgram("D", perm[3]+5),
-			createProgram("E", perm[4]+5),
-		}
-
-		whatToPassAsSecondInput := 0
-		amplifierHalted := make(map[int]bool)
-		for len(amplifierHalted) < len(amplifiers) {
-			for idx, amplifier := range amplifiers {
-				next, halted, err := amplifier.Run(whatToPassAsSecondInput)
-				if err != nil {
-					return 0, err
-				}
-				if halted {
-					amplifierHalted[idx] = true
-				}
-				whatToPassAsSecondInput = next
-			}
-		}
-		if whatToPassAsSecondInput > result {
-			result = whatToPassAsSecondInput
-		}
+	if err != nil {
+		return 0, err
 	}
 
+	result, phases, err := Search(intcode.ProgramCreator(seq), topology, workers)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Println("phases:", phases)
 	return result, nil
 }
 
-func programCreator(state []int) func(string, int) *IntCodeProgram {
-	// keep the initial sequence safe
-	safeBackup := make([]int, len(state))
-	copy(safeBackup, state)
-
-	return func(name string, phase int) *IntCodeProgram {
-		attempt := make([]int, len(safeBackup))
-		copy(attempt, safeBackup)
-		return &IntCodeProgram{name: name, memory: attempt, input: []int{phase}}
+// Search tries every phase setting of the topology with workers goroutines
+// and returns the highest result with its phases, the smallest ones on a tie
+// programs are created in a deterministic order with a single worker
+func Search(createProgram func() *intcode.Program, t *Topology, workers int) (int, []int, error) {
+	if workers < 1 {
+		workers = 1
 	}
-}
 
-// IntCodeProgram contains the input data
-type IntCodeProgram struct {
-	name      string
-	memory    []int
-	instrPtr  int
-	input     []int
-	output    []int
-	newOutput bool
-	halted    bool
-}
-
-// Run executes the program
-func (p *IntCodeProgram) Run(nextInput int) (int, bool, error) {
-	p.input = append(p.input, nextInput)
-	p.newOutput = false
-	for !p.halted && !p.newOutput {
-		err := p.ExecuteNextInstruction()
-		if err != nil {
-			return 0, false, err
+	perms := make(chan []int)
+	go func() {
+		gen := combin.NewPermutationGenerator(t.PhaseMax-t.PhaseMin+1, len(t.Amplifiers))
+		for gen.Next() {
+			perm := gen.Permutation(nil)
+			for i := range perm {
+				perm[i] += t.PhaseMin
+			}
+			perms <- perm
 		}
+		close(perms)
+	}()
+
+	var mu sync.Mutex
+	var firstErr error
+	result := 0
+	var best []int
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for phases := range perms {
+				signal, err := Evaluate(createProgram, t, phases)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("phases %v: %v", phases, err)
+				}
+				if err == nil && (best == nil || signal > result || signal == result && lessPhases(phases, best)) {
+					result, best = signal, phases
+				}
+				mu.Unlock()
+			}
+		}()
 	}
-	return p.Result(), p.halted, nil
-}
-
-// IsCompleted informs about the completeness of the program
-func (p *IntCodeProgram) IsCompleted() bool {
-	return p.memory[p.instrPtr] == 99
-}
-
-// ExecuteNextInstruction identifies instruction to execute and do it
-func (p *IntCodeProgram) ExecuteNextInstruction() error {
-	instrCode := p.memory[p.instrPtr]
-	opcode := instrCode % 100
-	switch opcode {
-	case 1:
-		p.ExecuteAdd()
-	case 2:
-		p.ExecuteMultiply()
-	case 3:
-		p.ExecuteInput()
-	case 4:
-		p.ExecuteOutput()
-	case 5:
-		p.ExecuteJumpIfTrue()
-	case 6:
-		p.ExecuteJumpIfFalse()
-	case 7:
-		p.ExecuteLessThan()
-	case 8:
-		p.ExecuteEquals()
-	case 99:
-		p.halted = true
-	default:
-		return errors.New("unknown opcode: " + strconv.Itoa(opcode))
-	}
-	return nil
-}
-
-// ExecuteEquals stores 1 in third if first == second else 0
-func (p *IntCodeProgram) ExecuteEquals() {
-	inst := p.memory[p.instrPtr : p.instrPtr+4]
-	immediateParams := getImmediateParamMap(inst[0])
+	wg.Wait()
 
-	firstParam := p.resolveParam(0, inst, immediateParams)
-	secondParam := p.resolveParam(1, inst, immediateParams)
-
-	if firstParam == secondParam {
-		p.memory[inst[3]] = 1
-	} else {
-		p.memory[inst[3]] = 0
+	if firstErr != nil {
+		return 0, nil, firstErr
 	}
-
-	p.instrPtr += 4
+	return result, best, nil
 }
 
-// ExecuteLessThan stores 1 in third if first < second else 0
-func (p *IntCodeProgram) ExecuteLessThan() {
-	inst := p.memory[p.instrPtr : p.instrPtr+4]
-	immediateParams := getImmediateParamMap(inst[0])
-
-	firstParam := p.resolveParam(0, inst, immediateParams)
-	secondParam := p.resolveParam(1, inst, immediateParams)
-
-	if firstParam < secondParam {
-		p.memory[inst[3]] = 1
-	} else {
-		p.memory[inst[3]] = 0
-	}
-
-	p.instrPtr += 4
-}
-
-// ExecuteJumpIfTrue jump to firstParam if non-zero
-func (p *IntCodeProgram) ExecuteJumpIfTrue() {
-	inst := p.memory[p.instrPtr : p.instrPtr+3]
-	immediateParams := getImmediateParamMap(inst[0])
-
-	firstParam := p.resolveParam(0, inst, immediateParams)
-	secondParam := p.resolveParam(1, inst, immediateParams)
-
-	if firstParam != 0 {
-		p.instrPtr = secondParam
-	} else {
-		p.instrPtr += 3
+// lessPhases tells if a comes before b in lexicographic order
+func lessPhases(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
 	}
-}
-
-// ExecuteJumpIfFalse jump to firstParam if zero
-func (p *IntCodeProgram) ExecuteJumpIfFalse() {
-	inst := p.memory[p.instrPtr : p.instrPtr+3]
-	immediateParams := getImmediateParamMap(inst[0])
-
-	firstParam := p.resolveParam(0, inst, immediateParams)
-	secondParam := p.resolveParam(1, inst, immediateParams)
-
-	if firstParam == 0 {
-		p.instrPtr = secondParam
-	} else {
-		p.instrPtr += 3
+	return false
+}
+
+// Evaluate runs the amplifiers of the topology with phases
+// and returns the last output of the output amplifier
+// amplifiers run in turn in the calling goroutine until they all halt
+func Evaluate(createProgram func() *intcode.Program, t *Topology, phases []int) (int, error) {
+	amplifiers := make(map[string]*intcode.Program)
+	for i, name := range t.Amplifiers {
+		p := createProgram()
+		p.Feed(phases[i])
+		amplifiers[name] = p
 	}
-}
-
-// ExecuteInput simulate a "read" and insert i at the address coming next
-func (p *IntCodeProgram) ExecuteInput() {
-	destIdx := p.memory[p.instrPtr+1]
-	p.memory[destIdx] = p.input[0]
-	p.instrPtr += 2
-	p.input = p.input[1:]
-}
-
-// ExecuteOutput simulate a print
-func (p *IntCodeProgram) ExecuteOutput() {
-	inst := p.memory[p.instrPtr : p.instrPtr+2]
-	immediateParams := getImmediateParamMap(inst[0])
-
-	firstParam := p.resolveParam(0, inst, immediateParams)
-
-	p.output = append(p.output, firstParam)
-	p.newOutput = true
-	p.instrPtr += 2
-}
-
-// ExecuteAdd handles addition opcode
-func (p *IntCodeProgram) ExecuteAdd() {
-	inst := p.memory[p.instrPtr : p.instrPtr+4]
-	immediateParams := getImmediateParamMap(inst[0])
-
-	firstParam := p.resolveParam(0, inst, immediateParams)
-	secondParam := p.resolveParam(1, inst, immediateParams)
-
-	p.memory[inst[3]] = firstParam + secondParam
-	p.instrPtr += 4
-}
-
-func getImmediateParamMap(opCodeInstr int) map[int]bool {
-	result := make(map[int]bool)
-	modeOpCode := strconv.Itoa(opCodeInstr)
-	for i := len(modeOpCode) - 3; i >= 0; i-- {
-		if modeOpCode[i] == '1' {
-			result[len(modeOpCode)-3-i] = true
+	amplifiers[t.Input].Feed(t.InputValue)
+
+	halted := make(map[string]bool)
+	result, hasResult := 0, false
+	for len(halted) < len(amplifiers) {
+		progress := false
+		for _, name := range t.Amplifiers {
+			if halted[name] {
+				continue
+			}
+			p := amplifiers[name]
+			status := p.Resume()
+			for ; status.Kind == intcode.HasOutput; status = p.Resume() {
+				progress = true
+				for _, to := range t.Links[name] {
+					amplifiers[to].Feed(status.Value)
+				}
+				if name == t.Output {
+					result, hasResult = status.Value, true
+				}
+			}
+			switch status.Kind {
+			case intcode.Halted:
+				halted[name] = true
+				progress = true
+			case intcode.Error:
+				return 0, fmt.Errorf("amplifier %v: %v", name, status.Err)
+			}
+		}
+		if !progress {
+			return 0, errors.New("amplifiers wait for inputs that never come")
 		}
 	}
-	return result
-}
-
-// ExecuteMultiply handles multiplication opcode
-func (p *IntCodeProgram) ExecuteMultiply() {
-	inst := p.memory[p.instrPtr : p.instrPtr+4]
-	immediateParams := getImmediateParamMap(inst[0])
-
-	firstParam := p.resolveParam(0, inst, immediateParams)
-	secondParam := p.resolveParam(1, inst, immediateParams)
 
-	p.memory[inst[3]] = firstParam * secondParam
-	p.instrPtr += 4
-}
-
-// Result is the output or the first memory address content if no output
-func (p *IntCodeProgram) Result() int {
-	return p.output[len(p.output)-1]
-}
-
-func (p *IntCodeProgram) resolveParam(i int, instruction []int, modes map[int]bool) int {
-	if modes[i] {
-		return instruction[i+1]
+	if !hasResult {
+		return 0, fmt.Errorf("amplifier %v produced no output", t.Output)
 	}
-	return p.memory[instruction[i+1]]
+	return result, nil
 }
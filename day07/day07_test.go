@@ -0,0 +1,105 @@
+package day07
+
+import (
+	"adventofcode2019/intcode"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	for _, test := range []struct {
+		program  string
+		topology string
+		result   int
+		phases   []int
+	}{
+		{"test1.txt", "series.topology", 43210, []int{4, 3, 2, 1, 0}},
+		{"test2.txt", "series.topology", 54321, []int{0, 1, 2, 3, 4}},
+		{"p2test", "feedback.topology", 139629729, []int{9, 8, 7, 6, 5}},
+	} {
+		seq, err := intcode.ReadProgram(test.program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		topology, err := ReadTopology(test.topology)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{1, 4} {
+			result, phases, err := Search(intcode.ProgramCreator(seq), topology, workers)
+			if err != nil {
+				t.Fatalf("%v, %v workers: %v", test.program, workers, err)
+			}
+			if result != test.result || !reflect.DeepEqual(phases, test.phases) {
+				t.Errorf("%v, %v workers: got %v with %v, want %v with %v",
+					test.program, workers, result, phases, test.result, test.phases)
+			}
+		}
+	}
+}
+
+func TestSearchTie(t *testing.T) {
+	// every phase setting gives 7, the smallest one must win
+	constant := intcode.ProgramCreator([]int{3, 9, 3, 9, 104, 7, 99, 0, 0, 0})
+	topology, err := ParseTopology(strings.NewReader("amplifiers A B C\nphases -1..3\nseries A B C\ninput A\noutput C\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		result, phases, err := Search(constant, topology, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != 7 || !reflect.DeepEqual(phases, []int{-1, 0, 1}) {
+			t.Fatalf("got %v with %v, want 7 with [-1 0 1]", result, phases)
+		}
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	for _, test := range []struct {
+		src string
+		err string
+	}{
+		{"amplifiers A B\nphases -3..-2\nA -> B\ninput A 4\noutput B\n", ""},
+		{"# comment\namplifiers A B\nphases 0..1\nfeedback A B\ninput A\noutput B\n", ""},
+		{"amplifiers A B\nphases 0-1\ninput A\noutput B\n", `line 2: invalid phase range "0-1"`},
+		{"amplifiers A B\nphases 0..x\ninput A\noutput B\n", "line 2: "},
+		{"amplifiers A B\nphases 0..0\ninput A\noutput B\n", "phases 0..0 can't be given to 2 amplifiers"},
+		{"amplifiers A A\nphases 0..1\ninput A\noutput A\n", "amplifier A declared twice"},
+		{"amplifiers A B\nphases 0..1\nA -> C\ninput A\noutput B\n", "unknown amplifier C in links"},
+		{"amplifiers A B\nphases 0..1\ninput C\noutput B\n", `unknown input amplifier "C"`},
+		{"amplifiers A B\nphases 0..1\nseries A\ninput A\noutput B\n", "line 3: series needs at least two amplifiers"},
+		{"amplifiers A B\nwire A B\n", `line 2: unknown statement "wire A B"`},
+		{"", "no amplifiers"},
+	} {
+		topology, err := ParseTopology(strings.NewReader(test.src))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: %v", test.src, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%q: got %v, %v, want the error %q", test.src, topology, err, test.err)
+		}
+	}
+
+	topology, err := ParseTopology(strings.NewReader("amplifiers A B\nphases -3..-2\nA -> B\ninput A 4\noutput B\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Topology{
+		Amplifiers: []string{"A", "B"},
+		PhaseMin:   -3,
+		PhaseMax:   -2,
+		Input:      "A",
+		InputValue: 4,
+		Output:     "B",
+		Links:      map[string][]string{"A": {"B"}},
+	}
+	if !reflect.DeepEqual(topology, want) {
+		t.Errorf("got %+v, want %+v", topology, want)
+	}
+}
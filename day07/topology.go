@@ -0,0 +1,167 @@
+package day07
+
+import (
+	"adventofcode2019/common"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// defaultTopology is the feedback loop of part 2
+const defaultTopology = `
+amplifiers A B C D E
+phases 5..9
+feedback A B C D E
+input A 0
+output E
+`
+
+// Topology describes how amplifiers are wired
+//
+// It is read from lines like:
+//
+//	amplifiers A B C D E   names of the amplifiers, in the order phases are given
+//	phases 5..9            range of the phase settings
+//	series A B C           links A -> B and B -> C
+//	feedback A B C         links A -> B, B -> C and C -> A
+//	A -> B                 sends every output of A to B
+//	input A 0              sends 0 to A after its phase (default 0)
+//	output C               the result is the last output of C
+//
+// A line starting with # is a comment.
+type Topology struct {
+	Amplifiers []string
+	PhaseMin   int
+	PhaseMax   int
+	Input      string
+	InputValue int
+	Output     string
+	// Links gives the amplifiers receiving the outputs of an amplifier
+	Links map[string][]string
+}
+
+// ReadTopology reads the topology stored in filepath
+func ReadTopology(filepath string) (*Topology, error) {
+	f := common.OpenFile(filepath)
+	defer common.CloseFile(f)
+
+	t, err := ParseTopology(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filepath, err)
+	}
+	return t, nil
+}
+
+// ParseTopology reads a topology description
+func ParseTopology(r io.Reader) (*Topology, error) {
+	t := &Topology{Links: make(map[string][]string)}
+
+	s := bufio.NewScanner(r)
+	lineNb := 0
+	for s.Scan() {
+		lineNb++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := t.parseLine(fields); err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNb, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return t, t.check()
+}
+
+func (t *Topology) parseLine(fields []string) error {
+	switch {
+	case fields[0] == "amplifiers":
+		t.Amplifiers = fields[1:]
+	case fields[0] == "phases":
+		if len(fields) != 2 {
+			return fmt.Errorf("phases needs a range like 5..9")
+		}
+		bounds := strings.Split(fields[1], "..")
+		if len(bounds) != 2 {
+			return fmt.Errorf("invalid phase range %q", fields[1])
+		}
+		var err error
+		if t.PhaseMin, err = strconv.Atoi(bounds[0]); err != nil {
+			return err
+		}
+		if t.PhaseMax, err = strconv.Atoi(bounds[1]); err != nil {
+			return err
+		}
+	case fields[0] == "series" || fields[0] == "feedback":
+		names := fields[1:]
+		if len(names) < 2 {
+			return fmt.Errorf("%v needs at least two amplifiers", fields[0])
+		}
+		for i := 0; i+1 < len(names); i++ {
+			t.link(names[i], names[i+1])
+		}
+		if fields[0] == "feedback" {
+			t.link(names[len(names)-1], names[0])
+		}
+	case fields[0] == "input":
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("input needs an amplifier and an optional value")
+		}
+		t.Input = fields[1]
+		if len(fields) == 3 {
+			v, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return err
+			}
+			t.InputValue = v
+		}
+	case fields[0] == "output":
+		if len(fields) != 2 {
+			return fmt.Errorf("output needs an amplifier")
+		}
+		t.Output = fields[1]
+	case len(fields) == 3 && fields[1] == "->":
+		t.link(fields[0], fields[2])
+	default:
+		return fmt.Errorf("unknown statement %q", strings.Join(fields, " "))
+	}
+	return nil
+}
+
+func (t *Topology) link(from, to string) {
+	t.Links[from] = append(t.Links[from], to)
+}
+
+// check validates the topology once read
+func (t *Topology) check() error {
+	if len(t.Amplifiers) == 0 {
+		return fmt.Errorf("no amplifiers")
+	}
+	known := make(map[string]bool)
+	for _, name := range t.Amplifiers {
+		if known[name] {
+			return fmt.Errorf("amplifier %v declared twice", name)
+		}
+		known[name] = true
+	}
+	for from, tos := range t.Links {
+		for _, name := range append([]string{from}, tos...) {
+			if !known[name] {
+				return fmt.Errorf("unknown amplifier %v in links", name)
+			}
+		}
+	}
+	if !known[t.Input] {
+		return fmt.Errorf("unknown input amplifier %q", t.Input)
+	}
+	if !known[t.Output] {
+		return fmt.Errorf("unknown output amplifier %q", t.Output)
+	}
+	if t.PhaseMax-t.PhaseMin+1 < len(t.Amplifiers) {
+		return fmt.Errorf("phases %v..%v can't be given to %v amplifiers", t.PhaseMin, t.PhaseMax, len(t.Amplifiers))
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"adventofcode2019/common"
 	"adventofcode2019/intcode"
 	"bufio"
+	"context"
 	"fmt"
 	col "github.com/fatih/color"
 	"strconv"
@@ -42,38 +43,39 @@ func Run(filepath string) (int, error) {
 
 	g := game{grid: make(map[point]tile)}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	in := make(chan int)
 	out := make(chan int)
-	quit := make(chan int)
-	go p.Run(in, out, quit)
-
-	for run := true; run; {
-		select {
-		case x := <-out:
-			y, info := <-out, <-out
-			fmt.Printf("received: %v, %v, %v\n", x, y, tile(info))
-			if x == -1 && y == 0 {
-				// we receive the score once the entire board is loaded
-				// so it starts the game, we can send the first joystick move
-				// once loaded, don't send a move at score reception but when
-				// receiving new position of ball
-				if !g.loaded {
-					go sendMove(g, in)
-				}
-				g.setScore(info)
-			} else {
-				t := tile(info)
-				g.placeTile(x, y, t)
-				// if we receive a ball position and the game is loaded...
-				// send a move
-				if t == ball && g.loaded {
-					go sendMove(g, in)
-				}
+	done := p.Start(ctx, in, out)
+
+	// out is closed when the program stops
+	for x := range out {
+		y, info := <-out, <-out
+		fmt.Printf("received: %v, %v, %v\n", x, y, tile(info))
+		if x == -1 && y == 0 {
+			// we receive the score once the entire board is loaded
+			// so it starts the game, we can send the first joystick move
+			// once loaded, don't send a move at score reception but when
+			// receiving new position of ball
+			if !g.loaded {
+				go sendMove(ctx, g, in)
+			}
+			g.setScore(info)
+		} else {
+			t := tile(info)
+			g.placeTile(x, y, t)
+			// if we receive a ball position and the game is loaded...
+			// send a move
+			if t == ball && g.loaded {
+				go sendMove(ctx, g, in)
 			}
-		case <-quit:
-			run = false
 		}
 	}
+	if err := <-done; err != nil {
+		return 0, err
+	}
 
 	g.printGrid()
 
@@ -82,10 +84,14 @@ func Run(filepath string) (int, error) {
 	return blocks, nil
 }
 
-func sendMove(g game, in chan int) {
+func sendMove(ctx context.Context, g game, in chan int) {
 	joystickMove := g.guessPaddleMove()
 	fmt.Printf("Move: %v\n", joystickMove)
-	in <- int(joystickMove)
+	// the game may be over before the move is read
+	select {
+	case in <- int(joystickMove):
+	case <-ctx.Done():
+	}
 }
 
 var (
@@ -45,11 +45,9 @@ func Run(filepath string) (int, error) {
 		droid: origin,
 	}
 
-	in := make(chan int)
-	out := make(chan int)
-	quit := make(chan int)
-	go p.Run(in, out, quit)
-	g.walkTheMap(in, out)
+	if err := g.exploreMap(p); err != nil {
+		return 0, err
+	}
 	g.printGrid()
 
 	graph := g.buildGraph()
@@ -81,22 +79,10 @@ var (
 	whiteOnGreen  = color.New(color.BgGreen, color.FgWhite)
 )
 
-type directionStack []direction
-
-func (s directionStack) Empty() bool      { return len(s) == 0 }
-func (s directionStack) Peek() direction  { return s[len(s)-1] }
-func (s *directionStack) Put(i direction) { (*s) = append((*s), i) }
-func (s *directionStack) Pop() direction {
-	d := (*s)[len(*s)-1]
-	(*s) = (*s)[:len(*s)-1]
-	return d
-}
-
 type game struct {
 	grid                 map[point]tile
 	droid                point
 	oxygenSystemPosition point
-	commandSent          direction
 }
 
 func (g *game) buildGraph() *dijkstra.Graph {
@@ -164,59 +150,41 @@ func (g *game) tileAt(p point) tile {
 	return t
 }
 
-func (g *game) walkTheMap(in, out chan int) {
-	dirs := g.directions()
-	for !dirs.Empty() {
-		dir := dirs.Pop()
-		t := g.handleDirection(dir, in, out)
-		if t != wall {
-			g.walkTheMap(in, out)
-			g.handleDirection(dir.revert(), in, out)
-		}
-	}
+// droidState is a position of the droid and the program which led it there
+type droidState struct {
+	position point
+	program  *intcode.Program
 }
 
-func (g *game) handleDirection(d direction, in, out chan int) tile {
-	g.commandSent = d
-	in <- int(g.commandSent)
-	t := tile(<-out)
-	g.handle(t)
-	return t
-}
+// exploreMap visits the map breadth first from the origin
+// the program is cloned to try each move, so the droid never has to go back
+func (g *game) exploreMap(p *intcode.Program) error {
+	queue := []droidState{{position: origin, program: p}}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		for _, d := range []direction{north, south, west, east} {
+			dest := s.position.destinationOfDirection(d)
+			if g.tileAt(dest) != unvisited {
+				continue
+			}
 
-func (g *game) directions() directionStack {
-	var result directionStack
-	if g.tileAt(g.droid.southTile()) == unvisited {
-		result.Put(south)
-	}
-	if g.tileAt(g.droid.eastTile()) == unvisited {
-		result.Put(east)
-	}
-	if g.tileAt(g.droid.westTile()) == unvisited {
-		result.Put(west)
-	}
-	if g.tileAt(g.droid.northTile()) == unvisited {
-		result.Put(north)
-	}
-	return result
-}
+			moved := s.program.Clone()
+			moved.Feed(int(d))
+			status := moved.Resume()
+			if status.Kind != intcode.HasOutput {
+				return fmt.Errorf("droid at %v moving %v: %v", s.position, d, status)
+			}
 
-func (g *game) handle(t tile) {
-	tileToMark := g.droid.destinationOfDirection(g.commandSent)
-	switch t {
-	case wall:
-		g.markPointAs(tileToMark, wall)
-	case oxygenSystem:
-		g.moveDroidTo(tileToMark)
-		g.markPointAs(tileToMark, oxygenSystem)
-	case visited:
-		g.moveDroidTo(tileToMark)
-		g.markPointAs(tileToMark, visited)
+			t := tile(status.Value)
+			g.markPointAs(dest, t)
+			if t != wall {
+				queue = append(queue, droidState{position: dest, program: moved})
+			}
+		}
 	}
-}
-
-func (g *game) moveDroidTo(dest point) {
-	g.droid = dest
+	return nil
 }
 
 func (g *game) markPointAs(p point, t tile) {
@@ -320,21 +288,6 @@ func (d direction) String() string {
 	}
 }
 
-func (d direction) revert() direction {
-	switch d {
-	case north:
-		return south
-	case west:
-		return east
-	case south:
-		return north
-	case east:
-		return west
-	default:
-		panic("reverting an unknown direction")
-	}
-}
-
 const (
 	north = direction(1)
 	south = direction(2)
@@ -3,12 +3,14 @@ package day17
 import (
 	"adventofcode2019/common"
 	"adventofcode2019/intcode"
+	"adventofcode2019/intcode/ascii"
 	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // Run is the entrypoint of day15 exercice
@@ -39,13 +41,17 @@ func Run(filepath string) (int, error) {
 	// create a program instance to get the map and compute commands from it
 	createProgram := intcode.ProgramCreator(seq)
 	p := createProgram()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	out := make(chan int)
-	quit := make(chan int)
-	go p.Run(nil, out, quit)
+	done := p.Start(ctx, nil, out)
 
 	spacemap := SpaceMap{}
 	spacemap.PopulateFrom(out)
-	<-quit
+	if err := <-done; err != nil {
+		return 0, err
+	}
 
 	// prepare functions A B C
 	cds := spacemap.robotCommands()
@@ -58,55 +64,43 @@ func Run(filepath string) (int, error) {
 	// override movement logic
 	manual.SetMemory(0, 2)
 
-	in2 := make(chan int)
-	out2 := make(chan int)
-	quit2 := make(chan int)
-	go manual.Run(in2, out2, quit2)
-
-	// stack commands to send to the program
-	go send([]string{
-		// Main:
-		strings.Join(res.mainRoutine, ","),
-		// Function A:
-		res.A.String(),
-		// Function B:
-		res.B.String(),
-		// Function C:
-		res.C.String(),
-		// Continuous video feed?
-		"n",
-	}, in2)
-
-	// output everything the program send to us
-	go output(out2)
-	// make the main goroutine wait for termination of second program to stop
-	<-quit2
-
-	return 0, nil
-}
-
-func output(out chan int) {
-	for c := range out {
-		if c > 0xff {
-			// score is greater than a byte
-			fmt.Printf("Stardust: %v\n", c)
-		} else {
-			fmt.Print(string(c))
+	conn := ascii.New(manual)
+	conn.Start(ctx)
+
+	// answer each prompt of the program, it halts if it doesn't like an answer
+	// so there is no need for a timeout
+	dialog := []struct{ prompt, answer string }{
+		{"Main:", strings.Join(res.mainRoutine, ",")},
+		{"Function A:", res.A.String()},
+		{"Function B:", res.B.String()},
+		{"Function C:", res.C.String()},
+		{"Continuous video feed?", "n"},
+	}
+	for _, d := range dialog {
+		lines, err := conn.ReadUntil(d.prompt, 0)
+		if err != nil {
+			return 0, err
 		}
+		fmt.Println(strings.Join(lines, "\n"))
+		fmt.Println(d.answer)
+		conn.WriteLine(d.answer)
 	}
-}
 
-func send(strings []string, ch chan int) {
-	// wait a bit to make printed line be readable ;)
-	time.Sleep(50 * time.Millisecond)
-	for _, str := range strings {
-		fmt.Printf("%v\n", str)
-		for _, c := range str {
-			ch <- int(c)
+	// output everything the program send to us until the amount of dust,
+	// the last value it writes and the only one which is not a character
+	for {
+		e, err := conn.ReadEvent(0)
+		if err == io.EOF {
+			return 0, fmt.Errorf("the program halted without the amount of dust")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if e.Kind == ascii.Number {
+			fmt.Printf("Stardust: %v\n", e.Value)
+			return e.Value, conn.Wait()
 		}
-		ch <- int('\n')
-		// wait a bit to make printed line be readable ;)
-		time.Sleep(50 * time.Millisecond)
+		fmt.Println(e.Text)
 	}
 }
 
@@ -0,0 +1,212 @@
+package intcode
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// Arithmetic tells how programs handle values which don't fit in an int
+type Arithmetic int
+
+const (
+	// WrappingArithmetic wraps around like Go integers, it is the default
+	WrappingArithmetic Arithmetic = iota
+	// CheckedArithmetic stops the program with an Overflow fault
+	CheckedArithmetic
+	// BigArithmetic computes the exact values with math/big
+	BigArithmetic
+)
+
+func (a Arithmetic) String() string {
+	switch a {
+	case WrappingArithmetic:
+		return "wrapping"
+	case CheckedArithmetic:
+		return "checked"
+	case BigArithmetic:
+		return "big"
+	default:
+		return "arithmetic(" + strconv.Itoa(int(a)) + ")"
+	}
+}
+
+// ParseArithmetic returns the arithmetic named s: wrapping, checked or big
+func ParseArithmetic(s string) (Arithmetic, bool) {
+	for _, a := range []Arithmetic{WrappingArithmetic, CheckedArithmetic, BigArithmetic} {
+		if a.String() == s {
+			return a, true
+		}
+	}
+	return WrappingArithmetic, false
+}
+
+// WithArithmetic selects the arithmetic of the built-in opcodes
+//
+// With BigArithmetic, values which don't fit in an int are kept aside and
+// MemoryAt returns 0 for them, use BigMemoryAt to read them. They can be
+// compared, added, multiplied and written to an output implementing
+// BigOutput, anything else, like using one as an address, is an Overflow
+// fault. Custom opcodes are given the int values only, so they fault too
+// when one of their parameters is too large.
+func WithArithmetic(a Arithmetic) Option {
+	return func(p *Program) {
+		p.arithmetic = a
+	}
+}
+
+// BigOutput is an Output receiving the values which don't fit in an int
+type BigOutput interface {
+	Output
+	WriteBig(v *big.Int) error
+}
+
+// BigSliceOutput collects the values written, large or not
+type BigSliceOutput struct {
+	Values []*big.Int
+}
+
+// Write appends v to the collected values
+func (s *BigSliceOutput) Write(v int) error {
+	s.Values = append(s.Values, big.NewInt(int64(v)))
+	return nil
+}
+
+// WriteBig appends v to the collected values
+func (s *BigSliceOutput) WriteBig(v *big.Int) error {
+	s.Values = append(s.Values, v)
+	return nil
+}
+
+// BigMemoryAt returns the value at a specific address, even if it doesn't fit in an int
+func (p *Program) BigMemoryAt(address int) *big.Int {
+	if v, ok := p.bigCells[address]; ok {
+		return new(big.Int).Set(v)
+	}
+	return big.NewInt(int64(p.mem.at(address)))
+}
+
+// minInt is the smallest int, its opposite overflows
+const minInt = -1 << (strconv.IntSize - 1)
+
+// addInts returns a+b, ok is false if it overflows
+func addInts(a, b int) (int, bool) {
+	s := a + b
+	if (a > 0 && b > 0 && s < 0) || (a < 0 && b < 0 && s >= 0) {
+		return 0, false
+	}
+	return s, true
+}
+
+// mulInts returns a*b, ok is false if it overflows
+func mulInts(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	m := a * b
+	if m/b != a || (a == -1 && b == minInt) || (b == -1 && a == minInt) {
+		return 0, false
+	}
+	return m, true
+}
+
+// fitsInt informs if v can be stored in an int
+func fitsInt(v *big.Int) bool {
+	return v.IsInt64() && int64(int(v.Int64())) == v.Int64()
+}
+
+// bigArg returns the value of parameter i as a big.Int
+func (p *Program) bigArg(args []int, i int) *big.Int {
+	if p.bigCells != nil && p.bigArgs[i] != nil {
+		return p.bigArgs[i]
+	}
+	return big.NewInt(int64(args[i]))
+}
+
+// isBig informs if parameter i of the current instruction doesn't fit in an int
+func (p *Program) isBig(i int) bool {
+	return p.bigCells != nil && p.bigArgs[i] != nil
+}
+
+// storeBig writes v at dest for the current instruction, like Store
+func (p *Program) storeBig(dest int, v *big.Int) {
+	if fitsInt(v) {
+		p.Store(dest, int(v.Int64()))
+		return
+	}
+	p.Store(dest, 0)
+	p.setBig(dest, v)
+}
+
+// setBig keeps v aside as the value at address, nil removes it
+func (p *Program) setBig(address int, v *big.Int) {
+	if v == nil {
+		if p.bigCells != nil {
+			delete(p.bigCells, address)
+		}
+		return
+	}
+	if p.bigCells == nil {
+		p.bigCells = make(map[int]*big.Int)
+	}
+	p.bigCells[address] = v
+}
+
+// computeChecked executes ADD or MUL with the checked or big arithmetic
+// exact computes with ints, ok is false if it overflows, and compute with big.Ints
+func (p *Program) computeChecked(args []int, exact func(a, b int) (int, bool), compute func(z, x, y *big.Int) *big.Int) error {
+	if !p.isBig(0) && !p.isBig(1) {
+		if v, ok := exact(args[0], args[1]); ok {
+			p.Store(args[2], v)
+			return nil
+		}
+		if p.arithmetic != BigArithmetic {
+			return p.overflow(-1)
+		}
+	}
+	p.storeBig(args[2], compute(new(big.Int), p.bigArg(args, 0), p.bigArg(args, 1)))
+	return nil
+}
+
+// compareBig compares the first two parameters when one of them doesn't fit in an int
+func (p *Program) compareBig(args []int) int {
+	return p.bigArg(args, 0).Cmp(p.bigArg(args, 1))
+}
+
+// writeBigOutput writes an output which doesn't fit in an int, like WriteOutput
+func (p *Program) writeBigOutput(v *big.Int) error {
+	out, ok := p.output.(BigOutput)
+	if !ok {
+		// a queued output can't be delivered either
+		return p.overflow(0)
+	}
+	if p.limit != nil {
+		if err := p.limit.checkOutput(p.instrPtr); err != nil {
+			return err
+		}
+	}
+	if p.recorder != nil {
+		if err := p.recorder.write(IOEvent{Kind: OutputEvent, Big: v.String()}); err != nil {
+			return err
+		}
+	}
+	if err := out.WriteBig(v); err != nil {
+		return err
+	}
+	if p.limit != nil {
+		p.limit.outputs++
+	}
+	if p.history != nil {
+		p.history.exchanged(OutputEvent, 0)
+	}
+	return nil
+}
+
+// overflow is the fault of a value which doesn't fit in an int:
+// parameter i, or the result of the instruction if i is negative
+func (p *Program) overflow(i int) *Fault {
+	instrCode := p.mem.at(p.instrPtr)
+	if i < 0 {
+		return &Fault{Kind: Overflow, IP: p.instrPtr, Instruction: instrCode, Opcode: instrCode % 100}
+	}
+	return p.fault(Overflow, i, instrCode, paramMode(instrCode, i), 0)
+}
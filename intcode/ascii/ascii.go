@@ -0,0 +1,216 @@
+// Package ascii turns an intcode program speaking ASCII into a line-oriented text interface
+//
+// Values written by the program are gathered in lines. Values outside the
+// ASCII range, like scores, are reported as numeric events instead.
+package ascii
+
+import (
+	"adventofcode2019/intcode"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned when the program writes nothing for the given duration
+var ErrTimeout = errors.New("timeout waiting for the program")
+
+// EventKind tells what the program wrote
+type EventKind int
+
+const (
+	// Line is a line of text, without its new line
+	Line EventKind = iota
+	// Number is a value outside the ASCII range
+	Number
+)
+
+// Event is something written by the program
+type Event struct {
+	Kind EventKind
+	Text string
+	// Value is set for numbers
+	Value int
+}
+
+// Conn exchanges lines with a running program
+type Conn struct {
+	p *intcode.Program
+	// Numbers are the numeric events skipped by ReadLine and ReadUntil
+	Numbers []int
+
+	mu     sync.Mutex
+	input  []int
+	ready  chan struct{}
+	line   []byte
+	events chan Event
+	done   chan struct{}
+	err    error
+}
+
+// New creates a connection to p, the program runs once started
+func New(p *intcode.Program) *Conn {
+	return &Conn{
+		p:      p,
+		ready:  make(chan struct{}, 1),
+		events: make(chan Event, 64),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start executes the program in a new goroutine until it halts, fails or ctx is done
+// ctx may be nil if the execution can't be cancelled
+func (c *Conn) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go func() {
+		err := c.p.RunIO(ctx, &connInput{c, ctx}, &connOutput{c, ctx})
+		if len(c.line) > 0 && err == nil {
+			c.events <- Event{Kind: Line, Text: string(c.line)}
+		}
+		c.err = err
+		close(c.events)
+		close(c.done)
+	}()
+}
+
+// Wait waits for the end of the program and returns its error, nil if it halted
+// events not read yet are dropped
+func (c *Conn) Wait() error {
+	go func() {
+		for range c.events {
+		}
+	}()
+	<-c.done
+	return c.err
+}
+
+// WriteLine sends s followed by a new line to the program
+func (c *Conn) WriteLine(s string) {
+	c.mu.Lock()
+	for _, r := range s + "\n" {
+		c.input = append(c.input, int(r))
+	}
+	c.mu.Unlock()
+
+	// wake up a waiting read
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// ReadEvent returns the next event written by the program
+// it fails with ErrTimeout if nothing comes within timeout, a non positive
+// timeout waits forever, and with io.EOF once the program halted
+func (c *Conn) ReadEvent(timeout time.Duration) (Event, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case e, ok := <-c.events:
+		if !ok {
+			<-c.done
+			if c.err != nil {
+				return Event{}, c.err
+			}
+			return Event{}, io.EOF
+		}
+		return e, nil
+	case <-expired:
+		return Event{}, ErrTimeout
+	}
+}
+
+// ReadLine returns the next line written by the program
+// numbers met on the way are appended to Numbers
+func (c *Conn) ReadLine(timeout time.Duration) (string, error) {
+	for {
+		e, err := c.ReadEvent(timeout)
+		if err != nil {
+			return "", err
+		}
+		if e.Kind == Number {
+			c.Numbers = append(c.Numbers, e.Value)
+			continue
+		}
+		return e.Text, nil
+	}
+}
+
+// ReadUntil returns the lines written by the program up to the line starting with prompt, included
+// timeout applies to each line
+func (c *Conn) ReadUntil(prompt string, timeout time.Duration) ([]string, error) {
+	var lines []string
+	for {
+		line, err := c.ReadLine(timeout)
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, prompt) {
+			return lines, nil
+		}
+	}
+}
+
+// connInput gives the program the characters of the lines written
+type connInput struct {
+	c   *Conn
+	ctx context.Context
+}
+
+func (in *connInput) Read() (int, error) {
+	c := in.c
+	for {
+		c.mu.Lock()
+		if len(c.input) > 0 {
+			v := c.input[0]
+			c.input = c.input[1:]
+			c.mu.Unlock()
+			return v, nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.ready:
+		case <-in.ctx.Done():
+			return 0, in.ctx.Err()
+		}
+	}
+}
+
+// connOutput gathers the characters written by the program in events
+type connOutput struct {
+	c   *Conn
+	ctx context.Context
+}
+
+func (out *connOutput) Write(v int) error {
+	c := out.c
+	var e Event
+	switch {
+	case v < 0 || v > 127:
+		e = Event{Kind: Number, Value: v}
+	case v == '\n':
+		e = Event{Kind: Line, Text: string(c.line)}
+		c.line = c.line[:0]
+	default:
+		c.line = append(c.line, byte(v))
+		return nil
+	}
+
+	select {
+	case c.events <- e:
+		return nil
+	case <-out.ctx.Done():
+		return out.ctx.Err()
+	}
+}
@@ -0,0 +1,82 @@
+package ascii
+
+import (
+	"adventofcode2019/intcode"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sumSource prompts for a line, writes the sum of its characters then "ok"
+// without a new line
+const sumSource = `
+        OUT #63         ; ?
+        OUT #10
+loop:   IN -> [c]
+        EQ [c], #10 -> [t]
+        JT [t], #done
+        ADD [sum], [c] -> [sum]
+        JMP #loop
+done:   OUT [sum]
+        OUT #111        ; o
+        OUT #107        ; k
+        HLT
+c:      .data 0
+t:      .data 0
+sum:    .data 0
+`
+
+func newConn(t *testing.T) *Conn {
+	t.Helper()
+	program, err := intcode.Assemble(strings.NewReader(sumSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(intcode.ProgramCreator(program)())
+}
+
+func TestConn(t *testing.T) {
+	c := newConn(t)
+	c.Start(nil)
+
+	lines, err := c.ReadUntil("?", time.Second)
+	if err != nil || len(lines) != 1 {
+		t.Fatalf("got %v, %v, want the prompt", lines, err)
+	}
+	c.WriteLine("hi")
+	// the sum is a number, skipped by ReadLine
+	// the last line has no new line, it is written when the program halts
+	line, err := c.ReadLine(time.Second)
+	if err != nil || line != "ok" {
+		t.Fatalf("got %q, %v, want ok", line, err)
+	}
+	if len(c.Numbers) != 1 || c.Numbers[0] != 'h'+'i' {
+		t.Errorf("got %v, want [%v]", c.Numbers, 'h'+'i')
+	}
+	if _, err := c.ReadEvent(time.Second); err != io.EOF {
+		t.Errorf("got %v, want %v", err, io.EOF)
+	}
+	if err := c.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnTimeout(t *testing.T) {
+	c := newConn(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Start(ctx)
+
+	if _, err := c.ReadLine(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// the program waits for a line
+	if _, err := c.ReadEvent(10 * time.Millisecond); err != ErrTimeout {
+		t.Errorf("got %v, want %v", err, ErrTimeout)
+	}
+	cancel()
+	if err := c.Wait(); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,466 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// AsmError is an assembly error located in the source
+type AsmError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *AsmError) Error() string {
+	return fmt.Sprintf("line %v, column %v: %v", e.Line, e.Column, e.Msg)
+}
+
+// Assemble turns an intcode assembly source into a program
+//
+// Each line holds an optional address ("0012:"), optional labels ("loop:")
+// and an instruction or a directive, ";" starts a comment:
+//
+//	loop: ADD [rb+3], #5 -> [104]
+//	      JT [flag], #loop
+//	      .data 1, 2, loop+1
+//
+// Operands are immediate (#x), position ([x]) or relative ([rb+x]).
+// Macros use the relative base as a stack pointer:
+// PUSH x, POP -> [x], CALL #f, RET and JMP #x.
+func Assemble(r io.Reader) ([]int, error) {
+	a := assembler{labels: make(map[string]int)}
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		if err := a.parseLine(line, s.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.emit()
+}
+
+// AssembleString is Assemble for an in-memory source
+func AssembleString(src string) ([]int, error) {
+	return Assemble(strings.NewReader(src))
+}
+
+type asmToken struct {
+	text string
+	col  int
+}
+
+type asmTerm struct {
+	negative bool
+	label    string
+	value    int
+	col      int
+}
+
+// asmExpr is a sum of numbers and labels
+// with here set, the address of the item holding it is added
+type asmExpr struct {
+	terms []asmTerm
+	here  bool
+}
+
+type asmOperand struct {
+	mode int
+	expr asmExpr
+}
+
+// asmItem is an instruction or a data directive at an address
+type asmItem struct {
+	line     int
+	address  int
+	opcode   int
+	operands []asmOperand
+	data     []asmExpr
+}
+
+func (item asmItem) size() int {
+	if item.data != nil {
+		return len(item.data)
+	}
+	return len(item.operands) + 1
+}
+
+type assembler struct {
+	items   []asmItem
+	labels  map[string]int
+	address int
+}
+
+// lineParser reads the tokens of a single line
+type lineParser struct {
+	line   int
+	tokens []asmToken
+	pos    int
+	// column after the last character, for errors at end of line
+	end int
+}
+
+func (lp *lineParser) errorf(col int, format string, args ...interface{}) *AsmError {
+	return &AsmError{Line: lp.line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (lp *lineParser) done() bool {
+	return lp.pos >= len(lp.tokens)
+}
+
+func (lp *lineParser) peek() asmToken {
+	if lp.done() {
+		return asmToken{col: lp.end}
+	}
+	return lp.tokens[lp.pos]
+}
+
+func (lp *lineParser) next() asmToken {
+	t := lp.peek()
+	lp.pos++
+	return t
+}
+
+func (lp *lineParser) expect(text string) error {
+	t := lp.next()
+	if t.text != text {
+		return lp.errorf(t.col, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+func tokenize(line int, text string) ([]asmToken, int, error) {
+	var tokens []asmToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ';':
+			return tokens, i + 1, nil
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '>':
+			tokens = append(tokens, asmToken{"->", i + 1})
+			i += 2
+		case strings.ContainsRune("#[]+-,:", r):
+			tokens = append(tokens, asmToken{string(r), i + 1})
+			i++
+		case r == '.' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			for i++; i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])); i++ {
+			}
+			tokens = append(tokens, asmToken{string(runes[start:i]), start + 1})
+		default:
+			return nil, 0, &AsmError{Line: line, Column: i + 1, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return tokens, len(runes) + 1, nil
+}
+
+func isNumber(text string) bool {
+	return text != "" && unicode.IsDigit([]rune(text)[0])
+}
+
+func isIdentifier(text string) bool {
+	if text == "" || text[0] == '.' {
+		return false
+	}
+	r := []rune(text)[0]
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func (a *assembler) parseLine(line int, text string) error {
+	tokens, end, err := tokenize(line, text)
+	if err != nil {
+		return err
+	}
+	lp := &lineParser{line: line, tokens: tokens, end: end}
+
+	// address prefixes and labels
+	for lp.pos+1 < len(lp.tokens) && lp.tokens[lp.pos+1].text == ":" {
+		t := lp.next()
+		lp.next()
+		switch {
+		case isNumber(t.text):
+			address, err := strconv.Atoi(t.text)
+			if err != nil {
+				return lp.errorf(t.col, "invalid address %q", t.text)
+			}
+			if address != a.address {
+				return lp.errorf(t.col, "address %v does not match current address %v", address, a.address)
+			}
+		case isIdentifier(t.text) && !strings.EqualFold(t.text, "rb"):
+			if _, exists := a.labels[t.text]; exists {
+				return lp.errorf(t.col, "label %q already defined", t.text)
+			}
+			a.labels[t.text] = a.address
+		default:
+			return lp.errorf(t.col, "invalid label %q", t.text)
+		}
+	}
+
+	if lp.done() {
+		return nil
+	}
+
+	t := lp.next()
+	var items []asmItem
+	switch {
+	case strings.EqualFold(t.text, ".data"):
+		data, err := lp.parseExprList()
+		if err != nil {
+			return err
+		}
+		items = []asmItem{{data: data}}
+	case isIdentifier(t.text):
+		items, err = lp.parseInstruction(t)
+		if err != nil {
+			return err
+		}
+	default:
+		return lp.errorf(t.col, "expected instruction, found %q", t.text)
+	}
+
+	if !lp.done() {
+		t := lp.peek()
+		return lp.errorf(t.col, "unexpected %q", t.text)
+	}
+
+	for _, item := range items {
+		item.line = line
+		item.address = a.address
+		a.items = append(a.items, item)
+		a.address += item.size()
+	}
+	return nil
+}
+
+func (lp *lineParser) parseExprList() ([]asmExpr, error) {
+	var result []asmExpr
+	for {
+		e, err := lp.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+		if lp.peek().text != "," {
+			return result, nil
+		}
+		lp.next()
+	}
+}
+
+func (lp *lineParser) parseExpr() (asmExpr, error) {
+	var e asmExpr
+	for {
+		negative := false
+		t := lp.next()
+		if t.text == "-" || t.text == "+" {
+			negative = t.text == "-"
+			t = lp.next()
+		}
+
+		switch {
+		case isNumber(t.text):
+			v, err := strconv.Atoi(t.text)
+			if err != nil {
+				return e, lp.errorf(t.col, "invalid number %q", t.text)
+			}
+			e.terms = append(e.terms, asmTerm{negative: negative, value: v, col: t.col})
+		case isIdentifier(t.text) && !strings.EqualFold(t.text, "rb"):
+			e.terms = append(e.terms, asmTerm{negative: negative, label: t.text, col: t.col})
+		default:
+			return e, lp.errorf(t.col, "expected number or label, found %q", t.text)
+		}
+
+		if next := lp.peek().text; next != "+" && next != "-" {
+			return e, nil
+		}
+	}
+}
+
+func (lp *lineParser) parseOperand() (asmOperand, error) {
+	t := lp.next()
+	switch t.text {
+	case "#":
+		e, err := lp.parseExpr()
+		return asmOperand{mode: immediateMode, expr: e}, err
+	case "[":
+		op := asmOperand{mode: positionMode}
+		if strings.EqualFold(lp.peek().text, "rb") {
+			lp.next()
+			op.mode = relativeMode
+			if lp.peek().text == "]" {
+				lp.next()
+				return op, nil
+			}
+			if sign := lp.peek().text; sign != "+" && sign != "-" {
+				return op, lp.errorf(lp.peek().col, "expected \"+\" or \"-\" after rb, found %q", sign)
+			}
+		}
+		e, err := lp.parseExpr()
+		if err != nil {
+			return op, err
+		}
+		op.expr = e
+		return op, lp.expect("]")
+	default:
+		return asmOperand{}, lp.errorf(t.col, "expected operand starting with \"#\" or \"[\", found %q", t.text)
+	}
+}
+
+// parseInstruction parses an instruction or a macro expanded in several items
+func (lp *lineParser) parseInstruction(mnemonic asmToken) ([]asmItem, error) {
+	name := strings.ToUpper(mnemonic.text)
+
+	stackTop := asmOperand{mode: relativeMode}
+	immediate := func(v int) asmOperand {
+		return asmOperand{mode: immediateMode, expr: asmExpr{terms: []asmTerm{{value: v}}}}
+	}
+	push := func(op asmOperand) []asmItem {
+		return []asmItem{
+			{opcode: 1, operands: []asmOperand{op, immediate(0), stackTop}},
+			{opcode: 9, operands: []asmOperand{immediate(1)}},
+		}
+	}
+
+	switch name {
+	case "PUSH":
+		op, err := lp.parseOperand()
+		return push(op), err
+	case "POP":
+		if err := lp.expect("->"); err != nil {
+			return nil, err
+		}
+		dest, err := lp.parseDestination()
+		return []asmItem{
+			{opcode: 9, operands: []asmOperand{immediate(-1)}},
+			{opcode: 1, operands: []asmOperand{stackTop, immediate(0), dest}},
+		}, err
+	case "CALL":
+		target, err := lp.parseOperand()
+		// the return address is right after ADD (4), ARB (2) and JT (3)
+		ret := asmOperand{mode: immediateMode, expr: asmExpr{terms: []asmTerm{{value: 9}}, here: true}}
+		return append(push(ret), asmItem{opcode: 5, operands: []asmOperand{immediate(1), target}}), err
+	case "RET":
+		return []asmItem{
+			{opcode: 9, operands: []asmOperand{immediate(-1)}},
+			{opcode: 5, operands: []asmOperand{immediate(1), stackTop}},
+		}, nil
+	case "JMP":
+		target, err := lp.parseOperand()
+		return []asmItem{{opcode: 5, operands: []asmOperand{immediate(1), target}}}, err
+	}
+
+	opcode := -1
+	for code, op := range builtins.opcodes {
+		if op != nil && op.Mnemonic == name {
+			opcode = code
+		}
+	}
+	if opcode < 0 {
+		return nil, lp.errorf(mnemonic.col, "unknown instruction %q", mnemonic.text)
+	}
+
+	info := builtins.opcodes[opcode]
+	operands := make([]asmOperand, len(info.Params))
+	first := true
+	for i := range operands {
+		if i == info.write {
+			continue
+		}
+		if !first {
+			if err := lp.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		first = false
+		op, err := lp.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = op
+	}
+	if info.write >= 0 {
+		if err := lp.expect("->"); err != nil {
+			return nil, err
+		}
+		dest, err := lp.parseDestination()
+		if err != nil {
+			return nil, err
+		}
+		operands[info.write] = dest
+	}
+	return []asmItem{{opcode: opcode, operands: operands}}, nil
+}
+
+func (lp *lineParser) parseDestination() (asmOperand, error) {
+	col := lp.peek().col
+	op, err := lp.parseOperand()
+	if err == nil && op.mode == immediateMode {
+		return op, lp.errorf(col, "destination can't be immediate")
+	}
+	return op, err
+}
+
+func (a *assembler) resolve(line int, item asmItem, e asmExpr) (int, error) {
+	v := 0
+	if e.here {
+		v = item.address
+	}
+	for _, t := range e.terms {
+		value := t.value
+		if t.label != "" {
+			address, ok := a.labels[t.label]
+			if !ok {
+				return 0, &AsmError{Line: line, Column: t.col, Msg: fmt.Sprintf("undefined label %q", t.label)}
+			}
+			value = address
+		}
+		if t.negative {
+			value = -value
+		}
+		v += value
+	}
+	return v, nil
+}
+
+func (a *assembler) emit() ([]int, error) {
+	result := make([]int, 0, a.address)
+	for _, item := range a.items {
+		if item.data != nil {
+			for _, e := range item.data {
+				v, err := a.resolve(item.line, item, e)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, v)
+			}
+			continue
+		}
+
+		code := item.opcode
+		factor := 100
+		params := make([]int, len(item.operands))
+		for i, op := range item.operands {
+			code += op.mode * factor
+			factor *= 10
+			v, err := a.resolve(item.line, item, op.expr)
+			if err != nil {
+				return nil, err
+			}
+			params[i] = v
+		}
+		result = append(result, code)
+		result = append(result, params...)
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package intcode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAssembleRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []int
+	}{
+		{"quine", []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}},
+		{"compare", []int{3, 12, 6, 12, 15, 1, 13, 14, 13, 4, 13, 99, -1, 0, 1, 9}},
+		{"large", []int{104, 1125899906842624, 99}},
+		{"data", []int{1105, 1, 5, 7, -3, 99}},
+	} {
+		var listing bytes.Buffer
+		if err := Disassemble(test.program).WriteListing(&listing); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		got, err := Assemble(&listing)
+		if err != nil {
+			t.Fatalf("%v: %v\n%v", test.name, err, listing.String())
+		}
+		if !reflect.DeepEqual(got, test.program) {
+			t.Errorf("%v: got %v, want %v\n%v", test.name, got, test.program, listing.String())
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		line int
+	}{
+		{"ADD #1, #2", 1},
+		{"ADD #1, #2 -> [3]\nFOO #1", 2},
+		{"JT #1, #nowhere", 1},
+	} {
+		_, err := AssembleString(test.src)
+		asmErr, ok := err.(*AsmError)
+		if !ok {
+			t.Errorf("%q: got %v, want an assembly error", test.src, err)
+			continue
+		}
+		if asmErr.Line != test.line {
+			t.Errorf("%q: got line %v, want %v", test.src, asmErr.Line, test.line)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package intcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Block is a sequence of instructions executed in a row
+type Block struct {
+	Start int `json:"start"`
+	// End is the address following the last instruction
+	End          int           `json:"end"`
+	Label        string        `json:"label,omitempty"`
+	Instructions []Instruction `json:"-"`
+	// Listing is the disassembly of the instructions
+	Listing []string `json:"listing"`
+	// Indirect is set when the block ends with a jump whose target is only known at runtime
+	Indirect bool `json:"indirect,omitempty"`
+}
+
+// Edge is a possible transfer of control between blocks
+type Edge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Kind is "jump" or "fallthrough"
+	Kind string `json:"kind"`
+}
+
+// Region is a range of memory which is not reached by the analysis
+type Region struct {
+	Start int `json:"start"`
+	// End is the address following the region
+	End int `json:"end"`
+}
+
+// CFG is the control-flow graph of a program
+type CFG struct {
+	Blocks []*Block `json:"blocks"`
+	Edges  []Edge   `json:"edges"`
+	// IndirectJumps are the addresses of jumps with a runtime target
+	IndirectJumps []int `json:"indirectJumps"`
+	// Unreachable are regions decoding as instructions never jumped to
+	Unreachable []Region `json:"unreachable"`
+	// Data are regions which do not look like code or are used as variables
+	Data []Region `json:"data"`
+}
+
+// BuildCFG recovers the control-flow graph of the program in memory
+// it relies on Disassemble to tell code from data
+func BuildCFG(memory []int) *CFG {
+	d := Disassemble(memory)
+	c := &CFG{
+		Blocks:        []*Block{},
+		Edges:         []Edge{},
+		IndirectJumps: []int{},
+		Unreachable:   []Region{},
+		Data:          []Region{},
+	}
+
+	blockStarts := findBlockStarts(d)
+	starts := make([]int, 0, len(blockStarts))
+	for address := range blockStarts {
+		starts = append(starts, address)
+	}
+	sort.Ints(starts)
+
+	for _, start := range starts {
+		b := d.block(start, blockStarts)
+		c.Blocks = append(c.Blocks, b)
+
+		last := b.Instructions[len(b.Instructions)-1]
+		if target, ok := last.JumpTarget(); ok {
+			if d.IsCode(target) && jumpMayHappen(last) {
+				c.Edges = append(c.Edges, Edge{From: start, To: target, Kind: "jump"})
+			}
+		} else if last.info().Jump {
+			b.Indirect = true
+			c.IndirectJumps = append(c.IndirectJumps, last.Address)
+		}
+		if last.FallsThrough() && d.IsCode(b.End) {
+			c.Edges = append(c.Edges, Edge{From: start, To: b.End, Kind: "fallthrough"})
+		}
+	}
+
+	c.findRegions(d)
+	return c
+}
+
+// findBlockStarts returns the addresses where a basic block starts:
+// the entry point, jump targets and instructions following a conditional jump
+func findBlockStarts(d *Disassembly) map[int]bool {
+	starts := map[int]bool{0: true}
+	for address := range d.labels {
+		if _, ok := d.code[address]; ok {
+			starts[address] = true
+		}
+	}
+	for address, inst := range d.code {
+		if _, ok := d.code[address+inst.Len()]; ok && inst.info().Jump {
+			starts[address+inst.Len()] = true
+		}
+	}
+	if _, ok := d.code[0]; !ok {
+		delete(starts, 0)
+	}
+	return starts
+}
+
+// block gathers the instructions of the block starting at start
+// a block ends with a jump, a halt, or before another block or data
+func (d *Disassembly) block(start int, blockStarts map[int]bool) *Block {
+	b := &Block{Start: start}
+	b.Label, _ = d.Label(start)
+	address := start
+	for {
+		inst := d.code[address]
+		b.Instructions = append(b.Instructions, inst)
+		b.Listing = append(b.Listing, fmt.Sprintf("%04d: %v", address, inst.format(d.labels)))
+
+		address += inst.Len()
+		_, next := d.code[address]
+		if inst.info().Stop || inst.info().Jump || !next || blockStarts[address] {
+			break
+		}
+	}
+	b.End = address
+	return b
+}
+
+// jumpMayHappen is false for jumps whose immediate condition never holds
+func jumpMayHappen(inst Instruction) bool {
+	if inst.Modes[0] != immediateMode {
+		return true
+	}
+	switch inst.info().When {
+	case JumpIfTrue:
+		return inst.Params[0] != 0
+	case JumpIfFalse:
+		return inst.Params[0] == 0
+	}
+	return true
+}
+
+// findRegions classifies the memory not owned by reachable instructions
+// a region is unreachable code if it decodes entirely as instructions
+// and none of its cells is used as a variable by the code, data otherwise
+func (c *CFG) findRegions(d *Disassembly) {
+	variables := make(map[int]bool)
+	for _, inst := range d.code {
+		for i, mode := range inst.Modes {
+			if mode == positionMode {
+				variables[inst.Params[i]] = true
+			}
+		}
+	}
+
+	for start := 0; start < len(d.memory); {
+		if d.owned[start] {
+			start++
+			continue
+		}
+		end := start
+		for end < len(d.memory) && !d.owned[end] {
+			end++
+		}
+
+		region := Region{Start: start, End: end}
+		if decodesEntirely(d, start, end) && !usesVariables(variables, start, end) {
+			c.Unreachable = append(c.Unreachable, region)
+		} else {
+			c.Data = append(c.Data, region)
+		}
+		start = end
+	}
+}
+
+func decodesEntirely(d *Disassembly, start, end int) bool {
+	for address := start; address < end; {
+		inst, err := d.set.Decode(d.memory[:end], address)
+		if err != nil {
+			return false
+		}
+		address += inst.Len()
+	}
+	return true
+}
+
+func usesVariables(variables map[int]bool, start, end int) bool {
+	for address := start; address < end; address++ {
+		if variables[address] {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the graph as JSON
+func (c *CFG) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language
+// blocks ending with an indirect jump are red, regions outside the graph are grey
+func (c *CFG) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph intcode {\n")
+	b.WriteString("  node [shape=box fontname=monospace];\n")
+	for _, block := range c.Blocks {
+		text := strings.Join(block.Listing, "\\l") + "\\l"
+		if block.Label != "" {
+			text = block.Label + ":\\l" + text
+		}
+		attrs := ""
+		if block.Indirect {
+			attrs = " color=red"
+		}
+		fmt.Fprintf(&b, "  b%d [label=\"%v\"%v];\n", block.Start, strings.Replace(text, `"`, `\"`, -1), attrs)
+	}
+	for _, e := range c.Edges {
+		style := ""
+		if e.Kind == "fallthrough" {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  b%d -> b%d%v;\n", e.From, e.To, style)
+	}
+	for _, r := range c.Unreachable {
+		fmt.Fprintf(&b, "  r%d [label=\"%04d-%04d unreachable\" style=dashed color=grey];\n", r.Start, r.Start, r.End-1)
+	}
+	for _, r := range c.Data {
+		fmt.Fprintf(&b, "  r%d [label=\"%04d-%04d data\" shape=note color=grey];\n", r.Start, r.Start, r.End-1)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,69 @@
+package intcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCFGDOT(t *testing.T) {
+	// writes 1 if the input is true, 0 then 1 otherwise
+	c := BuildCFG([]int{3, 20, 1005, 20, 7, 104, 0, 104, 1, 99})
+
+	var b bytes.Buffer
+	if err := c.WriteDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph intcode {
+  node [shape=box fontname=monospace];
+  b0 [label="0000: IN -> [20]\l0002: JT [20], #L0007\l"];
+  b5 [label="0005: OUT #0\l"];
+  b7 [label="L0007:\l0007: OUT #1\l0009: HLT\l"];
+  b0 -> b7;
+  b0 -> b5 [style=dashed];
+  b5 -> b7 [style=dashed];
+}
+`
+	if b.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", b.String(), want)
+	}
+}
+
+func TestCFGJSON(t *testing.T) {
+	// the jump target is read from memory, the cells after the halt are variables
+	c := BuildCFG([]int{3, 12, 6, 12, 15, 1, 13, 14, 13, 4, 13, 99, -1, 0, 1, 9})
+
+	var b bytes.Buffer
+	if err := c.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var got CFG
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Blocks) != 2 {
+		t.Fatalf("got %v blocks, want 2\n%v", len(got.Blocks), b.String())
+	}
+	if !got.Blocks[0].Indirect || got.Blocks[1].Indirect {
+		t.Errorf("got indirect %v and %v, want true and false", got.Blocks[0].Indirect, got.Blocks[1].Indirect)
+	}
+	if listing := strings.Join(got.Blocks[1].Listing, "\n"); listing != "0005: ADD [13], [14] -> [13]\n0009: OUT [13]\n0011: HLT" {
+		t.Errorf("got listing\n%v", listing)
+	}
+	for _, test := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"edges", got.Edges, []Edge{{From: 0, To: 5, Kind: "fallthrough"}}},
+		{"indirect jumps", got.IndirectJumps, []int{2}},
+		{"unreachable", got.Unreachable, []Region{}},
+		{"data", got.Data, []Region{{Start: 12, End: 16}}},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
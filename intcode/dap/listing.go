@@ -0,0 +1,82 @@
+package dap
+
+import (
+	"adventofcode2019/intcode"
+	"strconv"
+	"strings"
+)
+
+// listing is the disassembly of a program, shown as the source of its thread
+type listing struct {
+	text      string
+	textLines []string
+	// addresses of the instructions and data, in the order of the lines
+	addresses []int
+	lines     map[int]int
+	// byLine gives the address of a line, label lines included
+	byLine map[int]int
+	labels map[string]int
+	names  map[int]string
+}
+
+// newListing disassembles the program
+// it must not be called while the program runs in another goroutine
+func newListing(p *intcode.Program) (*listing, error) {
+	var b strings.Builder
+	if err := p.Disassemble(&b); err != nil {
+		return nil, err
+	}
+	l := &listing{
+		text:   b.String(),
+		lines:  make(map[int]int),
+		byLine: make(map[int]int),
+		labels: make(map[string]int),
+		names:  make(map[int]string),
+	}
+
+	// labels are on their own line before the address they name
+	var pending []string
+	var pendingLines []int
+	l.textLines = strings.Split(strings.TrimSuffix(l.text, "\n"), "\n")
+	for i, line := range l.textLines {
+		if strings.HasSuffix(line, ":") && !strings.Contains(line, " ") {
+			pending = append(pending, strings.TrimSuffix(line, ":"))
+			pendingLines = append(pendingLines, i+1)
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		address, err := strconv.Atoi(line[:colon])
+		if err != nil {
+			continue
+		}
+		l.addresses = append(l.addresses, address)
+		l.lines[address] = i + 1
+		l.byLine[i+1] = address
+		for j, name := range pending {
+			l.labels[name] = address
+			l.names[address] = name
+			l.byLine[pendingLines[j]] = address
+		}
+		pending, pendingLines = nil, nil
+	}
+	return l, nil
+}
+
+// address returns the address of a line, starting at 1
+func (l *listing) address(line int) (int, bool) {
+	address, ok := l.byLine[line]
+	return address, ok
+}
+
+// instruction returns the text of the line of address, without the address
+func (l *listing) instruction(address int) string {
+	line, ok := l.lines[address]
+	if !ok {
+		return ""
+	}
+	text := l.textLines[line-1]
+	return strings.TrimSpace(text[strings.Index(text, ":")+1:])
+}
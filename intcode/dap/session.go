@@ -0,0 +1,853 @@
+// Package dap debugs intcode programs from editors speaking the Debug Adapter Protocol
+//
+// Every program attached to a Session is a thread whose source is the
+// disassembly listing of the program. Breakpoints are set on the lines of
+// this listing, on addresses, or on labels like L0042, and apply to every
+// thread. Memory references name an address of a thread, like 42@3. Clones of attached programs stop on breakpoints too, they show up
+// as threads once stopped. The inputs and outputs of the programs are sent
+// to the debug console.
+package dap
+
+import (
+	"adventofcode2019/intcode"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrTerminated stops the programs when the client terminates the session
+var ErrTerminated = errors.New("terminated by the debugger")
+
+// the session can go back historyWindow*historyCheckpoints instructions
+const (
+	historyWindow      = 10000
+	historyCheckpoints = 100
+)
+
+// memoryChunk is the number of memory cells grouped in the variables view
+const memoryChunk = 100
+
+// program is the state of a thread
+type program struct {
+	id   int
+	p    *intcode.Program
+	name string
+	// attached is set for the programs given to Attach, clones are only listed once stopped
+	attached bool
+	started  bool
+	listing  *listing
+
+	// stopped is set while the program waits in Before for resume
+	stopped bool
+	resume  chan bool
+	// pause and step stop the program before its next instruction
+	pause, step bool
+	// stepOut stops the program once its relative base is below outBase
+	stepOut bool
+	outBase int
+	// skip lets the program execute the instruction it is resumed on
+	skip bool
+	// stoppedStep is the number of instructions executed at the last stop, -1 if
+	// unknown, so an input retried once fed doesn't hit its breakpoint again
+	stoppedStep int
+}
+
+// handle is what a variables reference stands for
+type handle struct {
+	prog *program
+	// kind is "registers", "memory" or "cells" for start to end
+	kind       string
+	start, end int
+}
+
+// Session is a debug session with a client
+type Session struct {
+	conn   *conn
+	r      *bufio.Reader
+	closer io.Closer
+
+	mu       sync.Mutex
+	programs map[*intcode.Program]*program
+	byID     map[int]*program
+	nextID   int
+	handles  []handle
+	// later are run once the response to the current request is sent
+	later []func()
+
+	// breakpoints are the addresses resolved from the three kinds of breakpoints
+	breakpoints      map[int]bool
+	lineBreakpoints  map[int][]sourceBreakpoint
+	functionNames    []string
+	instructionAddrs []int
+	// functionIDs identify the function breakpoints, verified once their label is known
+	functionIDs      []int
+	functionVerified []bool
+	nextBreakpointID int
+
+	stopOnEntry bool
+	// detached is set once the client is gone, terminated if it stopped the programs
+	detached, terminated bool
+	// closed is set once the programs are done
+	closed         bool
+	configured     chan struct{}
+	configuredOnce sync.Once
+}
+
+// NewSession creates a session with a client reading from r and writing to w,
+// like stdin and stdout
+func NewSession(r io.Reader, w io.Writer) *Session {
+	s := &Session{
+		conn:            &conn{w: w},
+		r:               bufio.NewReader(r),
+		programs:        make(map[*intcode.Program]*program),
+		byID:            make(map[int]*program),
+		breakpoints:     make(map[int]bool),
+		lineBreakpoints: make(map[int][]sourceBreakpoint),
+		configured:      make(chan struct{}),
+	}
+	if c, ok := w.(io.Closer); ok {
+		s.closer = c
+	}
+	return s
+}
+
+// Listen waits for a client on a TCP address, like localhost:4711
+func Listen(address string) (*Session, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	c, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(c, c), nil
+}
+
+// Configured is closed once the client has set its breakpoints,
+// or has left before, programs should not run earlier
+func (s *Session) Configured() <-chan struct{} {
+	return s.configured
+}
+
+// Attach debugs p as a new thread, it is meant to be given to intcode.Instrument
+// a history is attached to the program to step back
+func (s *Session) Attach(p *intcode.Program) {
+	if p.History() == nil {
+		p.SetHistory(intcode.NewHistory(historyWindow, historyCheckpoints))
+	}
+	l, err := newListing(p)
+
+	s.mu.Lock()
+	prog := s.register(p)
+	prog.attached = true
+	if err == nil {
+		prog.listing = l
+	}
+	s.resolveBreakpoints()
+	var verified []breakpoint
+	for i, name := range s.functionNames {
+		if address, ok := s.resolveName(name); ok && !s.functionVerified[i] {
+			s.functionVerified[i] = true
+			verified = append(verified, breakpoint{ID: s.functionIDs[i], Verified: true, InstructionReference: strconv.Itoa(address)})
+		}
+	}
+	s.mu.Unlock()
+
+	p.SetMonitor(s)
+	s.conn.event("thread", map[string]interface{}{"reason": "started", "threadId": prog.id})
+	for _, bp := range verified {
+		s.conn.event("breakpoint", map[string]interface{}{"reason": "changed", "breakpoint": bp})
+	}
+}
+
+// register creates the thread of p, mu must be held
+func (s *Session) register(p *intcode.Program) *program {
+	s.nextID++
+	prog := &program{id: s.nextID, p: p, name: fmt.Sprintf("program %v", s.nextID), resume: make(chan bool, 1), stoppedStep: -1}
+	s.programs[p] = prog
+	s.byID[prog.id] = prog
+	return prog
+}
+
+// Before stops the program when the client asks to
+func (s *Session) Before(p *intcode.Program) error {
+	s.mu.Lock()
+	if s.detached {
+		s.mu.Unlock()
+		if s.terminated {
+			return ErrTerminated
+		}
+		return nil
+	}
+
+	prog := s.programs[p]
+	executed := -1
+	if h := p.History(); h != nil {
+		executed = h.Step()
+	}
+	reason := ""
+	switch {
+	case prog == nil:
+		// a clone
+		if s.breakpoints[p.InstructionPointer()] {
+			prog = s.register(p)
+			reason = "breakpoint"
+		}
+	case !prog.started && s.stopOnEntry:
+		reason = "entry"
+	case prog.pause:
+		reason = "pause"
+	case prog.skip:
+	case prog.step:
+		reason = "step"
+	case prog.stepOut && p.RelativeBase() < prog.outBase:
+		reason = "step"
+	case s.breakpoints[p.InstructionPointer()] && (executed < 0 || executed != prog.stoppedStep):
+		reason = "breakpoint"
+	}
+	if prog != nil {
+		prog.started, prog.skip = true, false
+	}
+	if reason == "" {
+		s.mu.Unlock()
+		return nil
+	}
+	prog.stopped, prog.stoppedStep = true, executed
+	prog.pause, prog.step, prog.stepOut = false, false, false
+	s.mu.Unlock()
+
+	s.conn.event("stopped", map[string]interface{}{"reason": reason, "threadId": prog.id})
+	if terminate := <-prog.resume; terminate {
+		return ErrTerminated
+	}
+	return nil
+}
+
+// Exchanged sends the values read and written by the program to the debug console
+func (s *Session) Exchanged(p *intcode.Program, kind intcode.EventKind, v int) {
+	s.mu.Lock()
+	prog := s.programs[p]
+	if s.detached {
+		s.mu.Unlock()
+		return
+	}
+	if kind == intcode.HaltEvent && prog != nil {
+		delete(s.programs, p)
+		delete(s.byID, prog.id)
+	}
+	s.mu.Unlock()
+
+	name := "clone"
+	if prog != nil {
+		name = prog.name
+	}
+	if kind == intcode.HaltEvent {
+		if prog != nil {
+			s.conn.event("thread", map[string]interface{}{"reason": "exited", "threadId": prog.id})
+		}
+		return
+	}
+	s.conn.event("output", map[string]interface{}{"category": "stdout", "output": fmt.Sprintf("%v %v: %v\n", name, kind, v)})
+}
+
+// Close ends the session once the programs are done
+func (s *Session) Close() error {
+	s.detach(false)
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.conn.event("exited", map[string]interface{}{"exitCode": 0})
+	s.conn.event("terminated", nil)
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// detach lets the programs run without the client, or stops them if terminate is set
+func (s *Session) detach(terminate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detached {
+		return
+	}
+	s.detached, s.terminated = true, terminate
+	for _, prog := range s.programs {
+		if prog.stopped {
+			prog.stopped = false
+			prog.resume <- terminate
+		}
+	}
+	s.configuredOnce.Do(func() { close(s.configured) })
+}
+
+// Serve handles the requests of the client until it disconnects
+func (s *Session) Serve() error {
+	defer s.detach(false)
+	for {
+		content, err := readMessage(s.r)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if err == io.EOF || closed {
+				return nil
+			}
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return fmt.Errorf("invalid message: %v", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(&req)
+		if err := s.conn.respond(&req, body, err); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		later := s.later
+		s.later = nil
+		s.mu.Unlock()
+		for _, f := range later {
+			f()
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *Session) handle(req *request) (interface{}, error) {
+	var args struct {
+		ThreadID          int             `json:"threadId"`
+		FrameID           int             `json:"frameId"`
+		SourceReference   int             `json:"sourceReference"`
+		Source            source          `json:"source"`
+		Breakpoints       json.RawMessage `json:"breakpoints"`
+		VariablesRef      int             `json:"variablesReference"`
+		Expression        string          `json:"expression"`
+		StopOnEntry       bool            `json:"stopOnEntry"`
+		TerminateDebuggee *bool           `json:"terminateDebuggee"`
+		MemoryReference   string          `json:"memoryReference"`
+		InstructionOffset int             `json:"instructionOffset"`
+		InstructionCount  int             `json:"instructionCount"`
+	}
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Command {
+	case "initialize":
+		s.later = append(s.later, func() { s.conn.event("initialized", nil) })
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsFunctionBreakpoints:      true,
+			SupportsInstructionBreakpoints:   true,
+			SupportsDisassembleRequest:       true,
+			SupportsStepBack:                 true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+			SupportTerminateDebuggee:         true,
+			SupportsSteppingGranularity:      true,
+		}, nil
+	case "launch", "attach":
+		// the programs are created by the driver of the day
+		s.stopOnEntry = args.StopOnEntry
+		return nil, nil
+	case "configurationDone":
+		s.configuredOnce.Do(func() { close(s.configured) })
+		return nil, nil
+	case "setBreakpoints":
+		var bps []sourceBreakpoint
+		if err := unmarshalBreakpoints(args.Breakpoints, &bps); err != nil {
+			return nil, err
+		}
+		s.lineBreakpoints[args.Source.SourceReference] = bps
+		s.resolveBreakpoints()
+		return map[string]interface{}{"breakpoints": s.lineBreakpointResults(args.Source.SourceReference)}, nil
+	case "setFunctionBreakpoints":
+		var bps []functionBreakpoint
+		if err := unmarshalBreakpoints(args.Breakpoints, &bps); err != nil {
+			return nil, err
+		}
+		s.functionNames, s.functionIDs, s.functionVerified = nil, nil, nil
+		for _, bp := range bps {
+			s.nextBreakpointID++
+			s.functionNames = append(s.functionNames, bp.Name)
+			s.functionIDs = append(s.functionIDs, s.nextBreakpointID)
+			s.functionVerified = append(s.functionVerified, false)
+		}
+		s.resolveBreakpoints()
+		results := make([]breakpoint, 0, len(bps))
+		for i, name := range s.functionNames {
+			address, ok := s.resolveName(name)
+			if !ok {
+				// labels are only known once a program is attached
+				results = append(results, breakpoint{ID: s.functionIDs[i], Message: fmt.Sprintf("unknown address or label %q", name)})
+				continue
+			}
+			s.functionVerified[i] = true
+			results = append(results, breakpoint{ID: s.functionIDs[i], Verified: true, InstructionReference: strconv.Itoa(address)})
+		}
+		return map[string]interface{}{"breakpoints": results}, nil
+	case "setInstructionBreakpoints":
+		var bps []instructionBreakpoint
+		if err := unmarshalBreakpoints(args.Breakpoints, &bps); err != nil {
+			return nil, err
+		}
+		s.instructionAddrs = s.instructionAddrs[:0]
+		results := make([]breakpoint, 0, len(bps))
+		for _, bp := range bps {
+			// breakpoints apply to every program
+			address, _, err := s.parseReference(bp.InstructionReference)
+			if err != nil || address+bp.Offset < 0 {
+				results = append(results, breakpoint{Message: fmt.Sprintf("invalid address %q", bp.InstructionReference)})
+				continue
+			}
+			s.instructionAddrs = append(s.instructionAddrs, address+bp.Offset)
+			results = append(results, breakpoint{Verified: true, InstructionReference: strconv.Itoa(address + bp.Offset)})
+		}
+		s.resolveBreakpoints()
+		return map[string]interface{}{"breakpoints": results}, nil
+	case "threads":
+		return map[string]interface{}{"threads": s.threads()}, nil
+	case "continue":
+		prog, err := s.stoppedProgram(args.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		s.resumeProgram(prog)
+		return map[string]interface{}{"allThreadsContinued": false}, nil
+	case "next", "stepIn":
+		prog, err := s.stoppedProgram(args.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		prog.step = true
+		s.resumeProgram(prog)
+		return nil, nil
+	case "stepOut":
+		// functions usually return once they free their frame on the relative stack
+		prog, err := s.stoppedProgram(args.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		prog.stepOut, prog.outBase = true, prog.p.RelativeBase()
+		s.resumeProgram(prog)
+		return nil, nil
+	case "stepBack", "reverseContinue":
+		prog, err := s.stoppedProgram(args.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		reason, err := s.goBack(prog, req.Command == "reverseContinue")
+		if err != nil {
+			return nil, err
+		}
+		s.handles = nil
+		s.later = append(s.later, func() {
+			s.conn.event("stopped", map[string]interface{}{"reason": reason, "threadId": prog.id})
+		})
+		return nil, nil
+	case "pause":
+		prog, ok := s.byID[args.ThreadID]
+		if !ok {
+			return nil, fmt.Errorf("unknown thread %v", args.ThreadID)
+		}
+		if !prog.stopped {
+			prog.pause = true
+		}
+		return nil, nil
+	case "stackTrace":
+		prog, err := s.stoppedProgram(args.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		frame := s.frame(prog)
+		return map[string]interface{}{"stackFrames": []stackFrame{frame}, "totalFrames": 1}, nil
+	case "source":
+		prog, ok := s.byID[args.SourceReference]
+		if !ok {
+			prog, ok = s.byID[args.Source.SourceReference]
+		}
+		if !ok || prog.listing == nil {
+			return nil, fmt.Errorf("unknown source %v", args.SourceReference)
+		}
+		return map[string]interface{}{"content": prog.listing.text, "mimeType": "text/x-intcode"}, nil
+	case "scopes":
+		prog, err := s.stoppedProgram(args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scopes": []scope{
+			{Name: "Registers", VariablesReference: s.newHandle(handle{prog: prog, kind: "registers"})},
+			{Name: "Memory", VariablesReference: s.newHandle(handle{prog: prog, kind: "memory"}), Expensive: true},
+		}}, nil
+	case "variables":
+		if args.VariablesRef <= 0 || args.VariablesRef > len(s.handles) {
+			return nil, fmt.Errorf("unknown variables reference %v", args.VariablesRef)
+		}
+		h := s.handles[args.VariablesRef-1]
+		if !h.prog.stopped {
+			return nil, fmt.Errorf("%v is running", h.prog.name)
+		}
+		return map[string]interface{}{"variables": s.variables(h)}, nil
+	case "evaluate":
+		prog, err := s.stoppedProgram(args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := s.evaluate(prog, args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": result, "variablesReference": 0}, nil
+	case "disassemble":
+		return s.disassemble(args.MemoryReference, args.InstructionOffset, args.InstructionCount)
+	case "terminate":
+		s.later = append(s.later, func() { s.detach(true) })
+		return nil, nil
+	case "disconnect":
+		terminate := args.TerminateDebuggee != nil && *args.TerminateDebuggee
+		s.later = append(s.later, func() { s.detach(terminate) })
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request %q", req.Command)
+	}
+}
+
+func unmarshalBreakpoints(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid breakpoints: %v", err)
+	}
+	return nil
+}
+
+// resolveBreakpoints computes the addresses of the breakpoints, mu must be held
+// labels and lines are known once the programs are attached
+func (s *Session) resolveBreakpoints() {
+	s.breakpoints = make(map[int]bool)
+	for ref, bps := range s.lineBreakpoints {
+		prog, ok := s.byID[ref]
+		if !ok || prog.listing == nil {
+			continue
+		}
+		for _, bp := range bps {
+			if address, ok := prog.listing.address(bp.Line); ok {
+				s.breakpoints[address] = true
+			}
+		}
+	}
+	for _, name := range s.functionNames {
+		if address, ok := s.resolveName(name); ok {
+			s.breakpoints[address] = true
+		}
+	}
+	for _, address := range s.instructionAddrs {
+		s.breakpoints[address] = true
+	}
+}
+
+// lineBreakpointResults tells which breakpoints of the source are on an address
+func (s *Session) lineBreakpointResults(ref int) []breakpoint {
+	bps := s.lineBreakpoints[ref]
+	results := make([]breakpoint, 0, len(bps))
+	prog, ok := s.byID[ref]
+	for _, bp := range bps {
+		if !ok || prog.listing == nil {
+			results = append(results, breakpoint{Line: bp.Line, Message: "unknown source"})
+			continue
+		}
+		address, found := prog.listing.address(bp.Line)
+		if !found {
+			results = append(results, breakpoint{Line: bp.Line, Message: "no instruction on this line"})
+			continue
+		}
+		results = append(results, breakpoint{
+			Verified:             true,
+			Source:               &source{Name: prog.name, SourceReference: prog.id},
+			Line:                 prog.listing.lines[address],
+			InstructionReference: strconv.Itoa(address),
+		})
+	}
+	return results
+}
+
+// resolveName returns the address of a label known by an attached program, or of a number
+func (s *Session) resolveName(name string) (int, bool) {
+	if address, err := strconv.Atoi(name); err == nil {
+		return address, address >= 0
+	}
+	for _, prog := range s.byID {
+		if prog.listing == nil {
+			continue
+		}
+		if address, ok := prog.listing.labels[name]; ok {
+			return address, true
+		}
+	}
+	return 0, false
+}
+
+// threads lists the attached programs still running and the stopped clones
+func (s *Session) threads() []threadInfo {
+	result := []threadInfo{}
+	for _, prog := range s.byID {
+		if prog.attached || prog.stopped {
+			result = append(result, threadInfo{ID: prog.id, Name: prog.name})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// stoppedProgram returns the program of a thread, or frame, waiting for the client
+func (s *Session) stoppedProgram(id int) (*program, error) {
+	prog, ok := s.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown thread %v", id)
+	}
+	if !prog.stopped {
+		return nil, fmt.Errorf("%v is running", prog.name)
+	}
+	return prog, nil
+}
+
+// resumeProgram lets a stopped program go on once the response is sent, mu must be held
+func (s *Session) resumeProgram(prog *program) {
+	prog.stopped, prog.skip = false, true
+	s.handles = nil
+	s.later = append(s.later, func() { prog.resume <- false })
+}
+
+// goBack steps back one instruction, or until a breakpoint with all,
+// it returns the reason of the stop
+func (s *Session) goBack(prog *program, all bool) (string, error) {
+	h := prog.p.History()
+	if h == nil {
+		return "", intcode.ErrNoHistory
+	}
+	// the instructions will be executed again, their breakpoints hit again
+	prog.stoppedStep = -1
+	if err := prog.p.StepBack(1); err != nil {
+		return "", err
+	}
+	for all && !s.breakpoints[prog.p.InstructionPointer()] {
+		if h.Step() == h.Oldest() {
+			return "step", nil
+		}
+		if err := prog.p.StepBack(1); err != nil {
+			return "", err
+		}
+	}
+	if all {
+		return "breakpoint", nil
+	}
+	return "step", nil
+}
+
+// frame describes the current instruction of a stopped program
+func (s *Session) frame(prog *program) stackFrame {
+	ip := prog.p.InstructionPointer()
+	if prog.listing == nil {
+		// clones are disassembled once they stop
+		if l, err := newListing(prog.p); err == nil {
+			prog.listing = l
+		}
+	}
+	frame := stackFrame{ID: prog.id, Column: 1, InstructionPointerReference: reference(prog, ip)}
+	inst, err := prog.p.InstructionAt(ip)
+	if err != nil {
+		frame.Name = fmt.Sprintf("%04d: %v", ip, err)
+	} else {
+		frame.Name = fmt.Sprintf("%04d: %v", ip, inst)
+	}
+	if prog.listing != nil {
+		if line, ok := prog.listing.lines[ip]; ok {
+			frame.Source = &source{Name: prog.name, SourceReference: prog.id}
+			frame.Line = line
+		}
+		if label, ok := prog.listing.names[ip]; ok {
+			frame.Name = label + " " + frame.Name
+		}
+	}
+	return frame
+}
+
+func (s *Session) newHandle(h handle) int {
+	s.handles = append(s.handles, h)
+	return len(s.handles)
+}
+
+// variables lists the content of a handle
+func (s *Session) variables(h handle) []variable {
+	p := h.prog.p
+	cell := func(address int) variable {
+		name := strconv.Itoa(address)
+		if h.prog.listing != nil {
+			if label, ok := h.prog.listing.names[address]; ok {
+				name += " " + label
+			}
+		}
+		return variable{Name: name, Value: p.BigMemoryAt(address).String(), MemoryReference: reference(h.prog, address)}
+	}
+
+	result := []variable{}
+	switch h.kind {
+	case "registers":
+		halted := p.IsCompleted()
+		result = append(result,
+			variable{Name: "ip", Value: strconv.Itoa(p.InstructionPointer()), MemoryReference: reference(h.prog, p.InstructionPointer())},
+			variable{Name: "rb", Value: strconv.Itoa(p.RelativeBase())},
+			variable{Name: "halted", Value: strconv.FormatBool(halted)},
+		)
+		if hist := p.History(); hist != nil {
+			result = append(result, variable{Name: "step", Value: strconv.Itoa(hist.Step())})
+		}
+	case "memory":
+		// the program in chunks, then every extra cell in use
+		snapshot := p.Snapshot()
+		for start := 0; start < len(snapshot.Program); start += memoryChunk {
+			end := start + memoryChunk
+			if end > len(snapshot.Program) {
+				end = len(snapshot.Program)
+			}
+			ref := s.newHandle(handle{prog: h.prog, kind: "cells", start: start, end: end})
+			result = append(result, variable{Name: fmt.Sprintf("%04d-%04d", start, end-1), Value: "program", VariablesReference: ref})
+		}
+		extra := make([]int, 0, len(snapshot.ExtraMemory)+len(snapshot.BigMemory))
+		for address := range snapshot.ExtraMemory {
+			extra = append(extra, address)
+		}
+		for address := range snapshot.BigMemory {
+			if _, ok := snapshot.ExtraMemory[address]; !ok && address >= len(snapshot.Program) {
+				extra = append(extra, address)
+			}
+		}
+		sort.Ints(extra)
+		for _, address := range extra {
+			result = append(result, cell(address))
+		}
+	case "cells":
+		for address := h.start; address < h.end; address++ {
+			result = append(result, cell(address))
+		}
+	}
+	return result
+}
+
+// evaluate returns the value of a register, or of the memory at an address or a label
+func (s *Session) evaluate(prog *program, expression string) (string, error) {
+	expression = strings.Trim(strings.TrimSpace(expression), "[]")
+	switch expression {
+	case "ip":
+		return strconv.Itoa(prog.p.InstructionPointer()), nil
+	case "rb":
+		return strconv.Itoa(prog.p.RelativeBase()), nil
+	}
+	address, err := strconv.Atoi(expression)
+	if err != nil {
+		var ok bool
+		if prog.listing != nil {
+			address, ok = prog.listing.labels[expression]
+		}
+		if !ok {
+			return "", fmt.Errorf("unknown address or label %q", expression)
+		}
+	}
+	if address < 0 {
+		return "", fmt.Errorf("negative address %v", address)
+	}
+	return prog.p.BigMemoryAt(address).String(), nil
+}
+
+// reference is the memory reference of an address of prog
+func reference(prog *program, address int) string {
+	return fmt.Sprintf("%v@%v", address, prog.id)
+}
+
+// parseReference reads a memory reference made by reference, or a plain
+// address, prog is nil then
+func (s *Session) parseReference(ref string) (int, *program, error) {
+	parts := strings.Split(ref, "@")
+	address, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		return 0, nil, fmt.Errorf("invalid memory reference %q", ref)
+	}
+	if len(parts) == 1 {
+		return address, nil, nil
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid memory reference %q", ref)
+	}
+	prog, ok := s.byID[n]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown thread %v in memory reference %q", n, ref)
+	}
+	return address, prog, nil
+}
+
+// disassemble lists count instructions around the address of ref, by the lines
+// of the listing of its program, or of the first program for a plain address
+func (s *Session) disassemble(ref string, offset, count int) (interface{}, error) {
+	address, prog, err := s.parseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if prog == nil {
+		for _, candidate := range s.byID {
+			if candidate.listing != nil && (prog == nil || candidate.id < prog.id) {
+				prog = candidate
+			}
+		}
+	}
+	if prog != nil && prog.listing == nil {
+		// clones are disassembled once they stop
+		if l, err := newListing(prog.p); err == nil {
+			prog.listing = l
+		}
+	}
+	if prog == nil || prog.listing == nil {
+		return nil, errors.New("no program disassembled yet")
+	}
+
+	l := prog.listing
+	start := sort.SearchInts(l.addresses, address) + offset
+	result := make([]disassembledInstruction, 0, count)
+	for i := start; i < start+count; i++ {
+		if i < 0 || i >= len(l.addresses) {
+			result = append(result, disassembledInstruction{Address: "-1", Instruction: "??", PresentationHint: "invalid"})
+			continue
+		}
+		a := l.addresses[i]
+		result = append(result, disassembledInstruction{
+			Address:     strconv.Itoa(a),
+			Instruction: l.instruction(a),
+			Symbol:      l.names[a],
+			Location:    &source{Name: prog.name, SourceReference: prog.id},
+			Line:        l.lines[a],
+		})
+	}
+	return map[string]interface{}{"instructions": result}, nil
+}
@@ -0,0 +1,187 @@
+package dap
+
+import (
+	"adventofcode2019/intcode"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client is the editor side of a session
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	seq    int
+	msgs   chan map[string]interface{}
+	unread []map[string]interface{}
+}
+
+func newClient(t *testing.T, r io.Reader, w io.Writer) *client {
+	c := &client{t: t, w: w, msgs: make(chan map[string]interface{}, 100)}
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			content, err := readMessage(br)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			var m map[string]interface{}
+			if err := json.Unmarshal(content, &m); err == nil {
+				c.msgs <- m
+			}
+		}
+	}()
+	return c
+}
+
+func (c *client) send(command string, args interface{}) {
+	c.seq++
+	content, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+// wait returns the first message of kind named name, the other ones are kept
+func (c *client) wait(kind, name string) map[string]interface{} {
+	c.t.Helper()
+	matches := func(m map[string]interface{}) bool {
+		return m["type"] == kind && (m["command"] == name || m["event"] == name)
+	}
+	for i, m := range c.unread {
+		if matches(m) {
+			c.unread = append(c.unread[:i], c.unread[i+1:]...)
+			return m
+		}
+	}
+	for {
+		select {
+		case m, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("session closed waiting for %v %v", kind, name)
+			}
+			if matches(m) {
+				if kind == "response" && m["success"] != true {
+					c.t.Fatalf("%v failed: %v", name, m["message"])
+				}
+				return m
+			}
+			c.unread = append(c.unread, m)
+		case <-time.After(5 * time.Second):
+			c.t.Fatalf("timeout waiting for %v %v", kind, name)
+		}
+	}
+}
+
+// request sends a request and returns the body of its response
+func (c *client) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.send(command, args)
+	body, _ := c.wait("response", command)["body"].(map[string]interface{})
+	return body
+}
+
+// topFrame returns the instruction pointer reference of a thread
+func (c *client) topFrame(thread int) string {
+	c.t.Helper()
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": thread})["stackFrames"].([]interface{})
+	return frames[0].(map[string]interface{})["instructionPointerReference"].(string)
+}
+
+// instructionAt disassembles the instruction at a memory reference
+func (c *client) instructionAt(reference string) string {
+	c.t.Helper()
+	body := c.request("disassemble", map[string]interface{}{"memoryReference": reference, "instructionCount": 1})
+	instructions := body["instructions"].([]interface{})
+	return instructions[0].(map[string]interface{})["instruction"].(string)
+}
+
+func TestSession(t *testing.T) {
+	quine := []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}
+	product := []int{1102, 6, 7, 7, 4, 7, 99, 0}
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	session := NewSession(serverR, serverW)
+	served := make(chan error, 1)
+	go func() { served <- session.Serve() }()
+	c := newClient(t, clientR, clientW)
+
+	c.request("initialize", map[string]interface{}{"adapterID": "intcode"})
+	c.wait("event", "initialized")
+	c.request("launch", map[string]interface{}{"stopOnEntry": true})
+	c.request("configurationDone", nil)
+
+	<-session.Configured()
+	outputs := make([]*intcode.SliceOutput, 2)
+	done := make(chan error, 2)
+	for i, program := range [][]int{quine, product} {
+		p := intcode.ProgramCreator(program)()
+		session.Attach(p)
+		outputs[i] = &intcode.SliceOutput{}
+		go func(out *intcode.SliceOutput) { done <- p.RunIO(nil, nil, out) }(outputs[i])
+	}
+	c.wait("event", "stopped")
+	c.wait("event", "stopped")
+
+	// memory references tell the program they belong to
+	if ref := c.topFrame(1); !strings.HasPrefix(c.instructionAt(ref), "ARB") {
+		t.Errorf("thread 1 at %v: got %v, want ARB", ref, c.instructionAt(ref))
+	}
+	if ref := c.topFrame(2); !strings.HasPrefix(c.instructionAt(ref), "MUL") {
+		t.Errorf("thread 2 at %v: got %v, want MUL", ref, c.instructionAt(ref))
+	}
+
+	// a breakpoint on the line of address 4 in the listing of the quine
+	listing := c.request("source", map[string]interface{}{"sourceReference": 1})["content"].(string)
+	line := 0
+	for i, text := range strings.Split(listing, "\n") {
+		if strings.Contains(text, "0004:") {
+			line = i + 1
+		}
+	}
+	body := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"sourceReference": 1},
+		"breakpoints": []map[string]int{{"line": line}},
+	})
+	if bps := body["breakpoints"].([]interface{}); len(bps) != 1 || bps[0].(map[string]interface{})["verified"] != true {
+		t.Fatalf("breakpoint on line %v: got %v", line, bps)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	stopped := c.wait("event", "stopped")["body"].(map[string]interface{})
+	if stopped["reason"] != "breakpoint" || stopped["threadId"] != 1.0 {
+		t.Fatalf("got %v, want a breakpoint on thread 1", stopped)
+	}
+	if ref := c.topFrame(1); ref != "4@1" {
+		t.Errorf("got %v, want 4@1", ref)
+	}
+
+	c.request("stepBack", map[string]interface{}{"threadId": 1})
+	c.wait("event", "stopped")
+	if ref := c.topFrame(1); ref != "2@1" {
+		t.Errorf("after stepBack: got %v, want 2@1", ref)
+	}
+
+	// the programs run to their end without the client
+	c.request("disconnect", map[string]interface{}{"terminateDebuggee": false})
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	// the output delivered before stepping back is written again
+	want := append([]int{quine[0]}, quine...)
+	if !reflect.DeepEqual(outputs[0].Values, want) || !reflect.DeepEqual(outputs[1].Values, []int{42}) {
+		t.Errorf("got %v and %v, want %v and [42]", outputs[0].Values, outputs[1].Values, want)
+	}
+	clientW.Close()
+	serverW.Close()
+}
@@ -0,0 +1,549 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Debugger drives a Program one instruction at a time from a REPL
+// it either drives the program itself, or follows the programs given to
+// Attach as their Monitor
+type Debugger struct {
+	// p is the program the commands apply to
+	p           *Program
+	scanner     *bufio.Scanner
+	w           io.Writer
+	breakpoints map[int]bool
+	watchpoints map[int]bool
+	inputs      []int
+
+	// mu is held while an attached program is stopped, the others wait for it
+	mu       sync.Mutex
+	attached map[*Program]*attachedProgram
+	current  *attachedProgram
+	// resume is set by the commands letting the current program go on
+	resume bool
+	// detached is set once the debugger is left, programs then run freely
+	detached bool
+}
+
+// attachedProgram is a program followed by the debugger
+type attachedProgram struct {
+	id int
+	// until is the step to stop at, -1 to run until a breakpoint
+	until int
+	// stoppedStep is the step of the last stop, so an input retried doesn't stop again
+	stoppedStep int
+	// watched is set when the instruction executed at watchStep writes
+	// a watched cell at dest, which held before
+	watched   bool
+	watchStep int
+	dest      int
+	before    int
+}
+
+// NewDebugger creates a debugger reading commands from r and writing to w
+func NewDebugger(p *Program, r io.Reader, w io.Writer) *Debugger {
+	// the program is driven synchronously: inputs are fed, outputs are queued
+	p.input, p.output = nil, nil
+	if p.history == nil {
+		p.SetHistory(NewHistory(debuggerHistoryWindow, debuggerCheckpoints))
+	}
+	return &Debugger{
+		p:           p,
+		scanner:     bufio.NewScanner(r),
+		w:           w,
+		breakpoints: make(map[int]bool),
+		watchpoints: make(map[int]bool),
+	}
+}
+
+// NewAttachedDebugger creates a debugger for the programs given to Attach,
+// reading commands from r and writing to w
+func NewAttachedDebugger(r io.Reader, w io.Writer) *Debugger {
+	return &Debugger{
+		scanner:     bufio.NewScanner(r),
+		w:           w,
+		breakpoints: make(map[int]bool),
+		watchpoints: make(map[int]bool),
+		attached:    make(map[*Program]*attachedProgram),
+	}
+}
+
+// Attach follows p, it is meant to be given to Instrument
+// the program keeps its IO, the first one attached stops on its first instruction
+// and the next ones on breakpoints and watchpoints
+// a history is attached to the program to step back
+func (d *Debugger) Attach(p *Program) {
+	if p.history == nil {
+		p.SetHistory(NewHistory(debuggerHistoryWindow, debuggerCheckpoints))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a := &attachedProgram{id: len(d.attached) + 1, until: -1, stoppedStep: -1}
+	if a.id == 1 {
+		a.until = 0
+	}
+	d.attached[p] = a
+	p.SetMonitor(d)
+}
+
+// Before stops an attached program on a breakpoint, a watchpoint or at the end
+// of a step, and reads commands until it is resumed
+func (d *Debugger) Before(p *Program) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a := d.attached[p]
+	if d.detached || a == nil || p.history == nil {
+		// clones are not followed
+		return nil
+	}
+
+	executed := p.history.Step()
+	stop := ""
+	switch {
+	case a.watched && executed > a.watchStep:
+		stop = fmt.Sprintf("watchpoint [%v]: %v -> %v", a.dest, a.before, p.MemoryAt(a.dest))
+	case a.until >= 0 && executed >= a.until:
+		stop = "step"
+	case d.breakpoints[p.instrPtr] && executed != a.stoppedStep:
+		stop = fmt.Sprintf("breakpoint at %04d", p.instrPtr)
+	}
+	a.watched = false
+
+	if stop != "" {
+		fmt.Fprintf(d.w, "program %v: %v\n", a.id, stop)
+		a.until, a.stoppedStep = -1, executed
+		d.p, d.current, d.resume = p, a, false
+		d.showCurrent()
+		d.repl()
+		if d.detached {
+			return nil
+		}
+		// commands may have moved the program
+		executed = p.history.Step()
+		a.stoppedStep = executed
+	}
+
+	if inst, err := p.InstructionAt(p.instrPtr); err == nil {
+		if watched, dest := d.watchedDestination(p, inst); watched {
+			a.watched, a.watchStep, a.dest, a.before = true, executed, dest, p.MemoryAt(dest)
+		}
+	}
+	return nil
+}
+
+// Exchanged shows the values read and written by an attached program
+func (d *Debugger) Exchanged(p *Program, kind EventKind, v int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a := d.attached[p]
+	if d.detached || a == nil {
+		return
+	}
+	switch kind {
+	case InputEvent:
+		fmt.Fprintf(d.w, "program %v: input: %v\n", a.id, v)
+	case OutputEvent:
+		fmt.Fprintf(d.w, "program %v: output: %v\n", a.id, v)
+	case HaltEvent:
+		fmt.Fprintf(d.w, "program %v: halted\n", a.id)
+	}
+}
+
+// repl reads commands for the stopped program until it is resumed, the
+// debugger is left or the commands end
+func (d *Debugger) repl() {
+	for !d.resume {
+		fmt.Fprintf(d.w, "(icdb %v) ", d.current.id)
+		if !d.scanner.Scan() {
+			fmt.Fprintln(d.w)
+			d.detached = true
+			return
+		}
+		fields := strings.Fields(d.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			d.detached = true
+			return
+		}
+		if err := d.execute(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(d.w, "error: %v\n", err)
+		}
+	}
+}
+
+// the debugger can go back debuggerHistoryWindow*debuggerCheckpoints instructions
+const (
+	debuggerHistoryWindow = 10000
+	debuggerCheckpoints   = 100
+)
+
+const debuggerHelp = `commands:
+  s, step [n]          execute n instructions (default 1)
+  c, continue          run until a breakpoint, a watchpoint or the end
+  back [n]             go back n instructions (default 1)
+  rewind <addr>        go back before the last write at addr
+  b, break <addr>      stop before executing the instruction at addr
+  d, delete <addr>     remove the breakpoint at addr
+  w, watch <addr>      stop after a write at addr
+  unwatch <addr>       remove the watchpoint at addr
+  i, info              list breakpoints and watchpoints
+  r, regs              show instruction pointer and relative base
+  rb                   show relative base
+  m, mem <addr> [n]    dump n memory cells from addr (default 8)
+  set <addr> <value>   write value at addr
+  in, input <v>...     queue values for the next input instructions
+  l, list [addr] [n]   disassemble n instructions from addr (default ip)
+  save <file>          save a snapshot of the program
+  load <file>          restore the program from a snapshot
+  q, quit              leave the debugger, attached programs run to their end
+`
+
+// Run reads and executes commands until quit or end of input
+func (d *Debugger) Run() error {
+	d.showCurrent()
+	for {
+		fmt.Fprint(d.w, "(icdb) ")
+		if !d.scanner.Scan() {
+			fmt.Fprintln(d.w)
+			return d.scanner.Err()
+		}
+		fields := strings.Fields(d.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		if err := d.execute(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(d.w, "error: %v\n", err)
+		}
+	}
+}
+
+func (d *Debugger) execute(cmd string, args []string) error {
+	switch cmd {
+	case "h", "help":
+		fmt.Fprint(d.w, debuggerHelp)
+	case "s", "step":
+		n, err := optionalInt(args, 0, 1)
+		if err != nil {
+			return err
+		}
+		if d.current != nil {
+			d.current.until = d.p.history.Step() + n
+			d.resume = true
+			return nil
+		}
+		for i := 0; i < n; i++ {
+			stop, err := d.step()
+			if err != nil || stop {
+				return err
+			}
+		}
+		d.showCurrent()
+	case "c", "continue":
+		if d.current != nil {
+			d.resume = true
+			return nil
+		}
+		for {
+			stop, err := d.step()
+			if err != nil || stop {
+				return err
+			}
+			if d.breakpoints[d.p.instrPtr] {
+				fmt.Fprintf(d.w, "breakpoint at %04d\n", d.p.instrPtr)
+				d.showCurrent()
+				return nil
+			}
+		}
+	case "back":
+		n, err := optionalInt(args, 0, 1)
+		if err != nil {
+			return err
+		}
+		if err := d.p.StepBack(n); err != nil {
+			return err
+		}
+		d.showCurrent()
+	case "rewind":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		if _, err := d.p.RewindToLastWrite(address); err != nil {
+			return err
+		}
+		d.showCurrent()
+	case "b", "break":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		d.breakpoints[address] = true
+	case "d", "delete":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		delete(d.breakpoints, address)
+	case "w", "watch":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		d.watchpoints[address] = true
+	case "unwatch":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		delete(d.watchpoints, address)
+	case "i", "info":
+		fmt.Fprintf(d.w, "breakpoints: %v\n", sortedKeys(d.breakpoints))
+		fmt.Fprintf(d.w, "watchpoints: %v\n", sortedKeys(d.watchpoints))
+		fmt.Fprintf(d.w, "queued inputs: %v\n", d.inputs)
+	case "r", "regs":
+		fmt.Fprintf(d.w, "ip=%v rb=%v steps=%v halted=%v\n", d.p.instrPtr, d.p.relativeBase, d.p.history.Step(), d.p.halted)
+	case "rb":
+		fmt.Fprintf(d.w, "rb=%v\n", d.p.relativeBase)
+	case "m", "mem":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		n, err := optionalInt(args, 1, 8)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return fmt.Errorf("invalid count %v", n)
+		}
+		fmt.Fprintf(d.w, "%04d: %v\n", address, d.p.MemorySlice(address, address+n))
+	case "set":
+		address, err := requiredAddress(args)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("missing value")
+		}
+		v, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		d.p.SetMemory(address, v)
+	case "in", "input":
+		if d.current != nil {
+			return fmt.Errorf("attached programs read their own inputs")
+		}
+		for _, arg := range args {
+			v, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			d.inputs = append(d.inputs, v)
+		}
+	case "l", "list":
+		address, err := optionalInt(args, 0, d.p.instrPtr)
+		if err != nil {
+			return err
+		}
+		if address < 0 {
+			return fmt.Errorf("negative address %v", address)
+		}
+		n, err := optionalInt(args, 1, 5)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return fmt.Errorf("invalid count %v", n)
+		}
+		d.list(address, n)
+	case "save":
+		if len(args) == 0 {
+			return fmt.Errorf("missing file")
+		}
+		return d.p.Snapshot().Save(args[0])
+	case "load":
+		if len(args) == 0 {
+			return fmt.Errorf("missing file")
+		}
+		s, err := LoadSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		d.restore(s)
+		d.showCurrent()
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return nil
+}
+
+// step executes the current instruction
+// it reports a stop if a watchpoint is hit or if the program halted
+func (d *Debugger) step() (bool, error) {
+	if d.p.halted {
+		fmt.Fprintln(d.w, "program halted")
+		return true, nil
+	}
+
+	inst, err := d.p.InstructionAt(d.p.instrPtr)
+	if err != nil {
+		return true, err
+	}
+
+	watched, dest := d.watchedDestination(d.p, inst)
+	before := 0
+	if watched {
+		before = d.p.MemoryAt(dest)
+	}
+
+	// whatever its opcode, an instruction missing an input is executed again once fed
+	err = d.p.ExecuteNextInstruction()
+	for err == ErrNoInput {
+		v, inputErr := d.nextInput()
+		if inputErr != nil {
+			return true, inputErr
+		}
+		d.p.Feed(v)
+		err = d.p.ExecuteNextInstruction()
+	}
+	if err != nil {
+		return true, err
+	}
+
+	for _, v := range d.p.pendingOutput {
+		fmt.Fprintf(d.w, "output: %v\n", v)
+	}
+	d.p.pendingOutput = nil
+
+	if watched {
+		fmt.Fprintf(d.w, "watchpoint [%v]: %v -> %v\n", dest, before, d.p.MemoryAt(dest))
+		d.showCurrent()
+		return true, nil
+	}
+	if d.p.halted {
+		fmt.Fprintln(d.w, "program halted")
+		return true, nil
+	}
+	return false, nil
+}
+
+// restore puts the program in the state of the snapshot, like Restore, but it
+// keeps its IO, its instruction set, its limits, its monitor and the other tools
+func (d *Debugger) restore(s *Snapshot) {
+	restored := s.Restore()
+	d.p.mem, d.p.programLen, d.p.bigCells = restored.mem, restored.programLen, restored.bigCells
+	d.p.instrPtr, d.p.relativeBase, d.p.halted = restored.instrPtr, restored.relativeBase, restored.halted
+	d.p.arithmetic = restored.arithmetic
+	d.p.pendingInput, d.p.pendingOutput = restored.pendingInput, restored.pendingOutput
+	d.p.SetHistory(NewHistory(debuggerHistoryWindow, debuggerCheckpoints))
+	for _, v := range d.p.pendingOutput {
+		fmt.Fprintf(d.w, "output: %v\n", v)
+	}
+	d.p.pendingOutput = nil
+}
+
+// watchedDestination gives the address written by inst in p if it is watched
+func (d *Debugger) watchedDestination(p *Program, inst Instruction) (bool, int) {
+	write := inst.info().write
+	if write < 0 {
+		return false, 0
+	}
+	dest := inst.Params[write]
+	if inst.Modes[write] == relativeMode {
+		dest += p.relativeBase
+	}
+	return d.watchpoints[dest], dest
+}
+
+// nextInput pops a queued input or asks for one
+func (d *Debugger) nextInput() (int, error) {
+	for len(d.inputs) == 0 {
+		fmt.Fprint(d.w, "input> ")
+		if !d.scanner.Scan() {
+			if err := d.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+		for _, field := range strings.Fields(d.scanner.Text()) {
+			v, err := strconv.Atoi(field)
+			if err != nil {
+				return 0, err
+			}
+			d.inputs = append(d.inputs, v)
+		}
+	}
+	v := d.inputs[0]
+	d.inputs = d.inputs[1:]
+	return v, nil
+}
+
+func (d *Debugger) showCurrent() {
+	if d.p.halted {
+		return
+	}
+	d.list(d.p.instrPtr, 1)
+}
+
+func (d *Debugger) list(address, n int) {
+	for i := 0; i < n; i++ {
+		marker := "  "
+		if address == d.p.instrPtr {
+			marker = "=>"
+		}
+		if d.breakpoints[address] {
+			marker = "*" + marker[1:]
+		}
+		inst, err := d.p.InstructionAt(address)
+		if err != nil {
+			fmt.Fprintf(d.w, "%v %04d: .data %v\n", marker, address, d.p.MemoryAt(address))
+			address++
+			continue
+		}
+		fmt.Fprintf(d.w, "%v %04d: %v\n", marker, address, inst)
+		address += inst.Len()
+	}
+}
+
+func requiredAddress(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("missing address")
+	}
+	address, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if address < 0 {
+		return 0, fmt.Errorf("negative address %v", address)
+	}
+	return address, nil
+}
+
+func optionalInt(args []string, idx, defaultValue int) (int, error) {
+	if len(args) <= idx {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(args[idx])
+}
+
+func sortedKeys(m map[int]bool) []int {
+	result := make([]int, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Ints(result)
+	return result
+}
@@ -0,0 +1,79 @@
+package intcode
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachedDebugger(t *testing.T) {
+	// reads a value, adds 1 to it and writes it
+	program := []int{3, 9, 1001, 9, 1, 9, 4, 9, 99, 0}
+
+	for _, test := range []struct {
+		name     string
+		commands string
+		want     []string
+	}{
+		{"breakpoint", "b 2\nc\nmem 9 1\nc\n", []string{"breakpoint at 0002", "0009: [41]", "output: 42"}},
+		{"watchpoint", "w 9\nc\nc\nc\n", []string{"watchpoint [9]: 0 -> 41", "watchpoint [9]: 41 -> 42"}},
+		{"step back", "s 2\nback 1\nregs\nq\n", []string{"ip=2 rb=0 steps=1"}},
+		{"invalid count", "mem 0 0\nq\n", []string{"error: invalid count 0"}},
+	} {
+		var w bytes.Buffer
+		d := NewAttachedDebugger(strings.NewReader(test.commands), &w)
+		p := ProgramCreator(program)()
+		d.Attach(p)
+
+		in, out, quit := make(chan int, 1), make(chan int, 1), make(chan int, 1)
+		in <- 41
+		if err := p.Run(in, out, quit); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if v := <-out; v != 42 {
+			t.Errorf("%v: got %v, want 42", test.name, v)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.String(), want) {
+				t.Errorf("%v: %q not found in\n%v", test.name, want, w.String())
+			}
+		}
+	}
+}
+
+func TestDebuggerLoadKeepsTracer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	enc := &sliceEncoder{}
+	p := ProgramCreator(traceProgram)()
+	p.SetTracer(NewTracer(enc))
+
+	var w bytes.Buffer
+	commands := fmt.Sprintf("save %v\ns\nload %v\ns\nq\n", path, path)
+	if err := NewDebugger(p, strings.NewReader(commands), &w).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(enc.entries) != 2 || enc.entries[1].IP != 0 {
+		t.Errorf("got %+v, want the first instruction traced twice\n%v", enc.entries, w.String())
+	}
+}
+
+func TestAttachedDebuggerRetriedInput(t *testing.T) {
+	var w bytes.Buffer
+	d := NewAttachedDebugger(strings.NewReader("s 1\nregs\nq\n"), &w)
+	p := ProgramCreator([]int{3, 9, 4, 9, 99})()
+	d.Attach(p)
+
+	if err := p.RunIO(nil, nil, nil); err != ErrNoInput {
+		t.Fatalf("got %v, want ErrNoInput", err)
+	}
+	// the input instruction is executed again, it counts once
+	p.Feed(42)
+	if got := p.Resume(); got.Kind != HasOutput || got.Value != 42 {
+		t.Errorf("got %v, want output(42)", got)
+	}
+	if want := "ip=2 rb=0 steps=1"; !strings.Contains(w.String(), want) {
+		t.Errorf("%q not found in\n%v", want, w.String())
+	}
+}
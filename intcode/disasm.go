@@ -0,0 +1,383 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parameter modes understood by the VM
+const (
+	positionMode  = 0
+	immediateMode = 1
+	relativeMode  = 2
+)
+
+// Instruction is a decoded intcode instruction
+type Instruction struct {
+	Address int
+	Opcode  int
+	Modes   []int
+	Params  []int
+
+	// op is the declaration of the opcode in the instruction set used to decode it
+	op *Opcode
+}
+
+// unknownOpcode describes instructions whose opcode is not declared
+var unknownOpcode = &Opcode{write: -1}
+
+// info returns the declaration of the opcode
+// instructions not decoded are looked up in the built-in instruction set
+func (i Instruction) info() *Opcode {
+	if i.op != nil {
+		return i.op
+	}
+	if op := builtins.lookup(i.Opcode); op != nil {
+		return op
+	}
+	return unknownOpcode
+}
+
+// Len is the number of memory cells used by the instruction
+func (i Instruction) Len() int {
+	return len(i.Params) + 1
+}
+
+// Mnemonic is the assembly name of the instruction
+func (i Instruction) Mnemonic() string {
+	return i.info().Mnemonic
+}
+
+// Raw returns the memory cells encoding the instruction
+func (i Instruction) Raw() []int {
+	code := i.Opcode
+	factor := 100
+	for _, m := range i.Modes {
+		code += m * factor
+		factor *= 10
+	}
+	return append([]int{code}, i.Params...)
+}
+
+// JumpTarget returns the destination of a jump whose target is immediate
+func (i Instruction) JumpTarget() (int, bool) {
+	if !i.info().Jump || i.Modes[1] != immediateMode {
+		return 0, false
+	}
+	return i.Params[1], true
+}
+
+// FallsThrough informs if the next instruction may be executed after this one
+func (i Instruction) FallsThrough() bool {
+	if i.info().Stop {
+		return false
+	}
+	if !i.info().Jump {
+		return true
+	}
+	switch i.info().When {
+	case JumpIfTrue:
+		// JT #non-zero, x
+		return i.Modes[0] != immediateMode || i.Params[0] == 0
+	case JumpIfFalse:
+		// JF #0, x
+		return i.Modes[0] != immediateMode || i.Params[0] != 0
+	}
+	return true
+}
+
+// String formats the instruction without address nor labels
+func (i Instruction) String() string {
+	return i.format(nil)
+}
+
+func (i Instruction) format(labels map[int]string) string {
+	info := i.info()
+	var reads []string
+	dest := ""
+	for idx, param := range i.Params {
+		operand := formatOperand(i.Modes[idx], param)
+		if info.Jump && idx == 1 && i.Modes[idx] == immediateMode {
+			if label, ok := labels[param]; ok {
+				operand = "#" + label
+			}
+		}
+		if idx == info.write {
+			dest = operand
+		} else {
+			reads = append(reads, operand)
+		}
+	}
+
+	var strb strings.Builder
+	strb.WriteString(info.Mnemonic)
+	if len(reads) > 0 {
+		strb.WriteString(" ")
+		strb.WriteString(strings.Join(reads, ", "))
+	}
+	if dest != "" {
+		strb.WriteString(" -> ")
+		strb.WriteString(dest)
+	}
+	return strb.String()
+}
+
+func formatOperand(mode, param int) string {
+	switch mode {
+	case immediateMode:
+		return "#" + strconv.Itoa(param)
+	case relativeMode:
+		if param < 0 {
+			return "[rb" + strconv.Itoa(param) + "]"
+		}
+		return "[rb+" + strconv.Itoa(param) + "]"
+	default:
+		return "[" + strconv.Itoa(param) + "]"
+	}
+}
+
+// Decode reads the instruction stored at address in memory
+func Decode(memory []int, address int) (Instruction, error) {
+	return builtins.Decode(memory, address)
+}
+
+// Decode reads the instruction stored at address in memory, with the opcodes of s
+func (s *InstructionSet) Decode(memory []int, address int) (Instruction, error) {
+	return s.decode(func(a int) int { return memory[a] }, len(memory), address)
+}
+
+// InstructionAt decodes the instruction at address in the program memory
+func (p *Program) InstructionAt(address int) (Instruction, error) {
+	return p.instructions.decode(p.MemoryAt, -1, address)
+}
+
+// decode an instruction using fetch to access memory
+// size limits the addressable memory, -1 if unbounded
+func (s *InstructionSet) decode(fetch func(int) int, size int, address int) (Instruction, error) {
+	if address < 0 || (size >= 0 && address >= size) {
+		return Instruction{}, fmt.Errorf("address %v out of memory", address)
+	}
+	instrCode := fetch(address)
+	if instrCode < 0 {
+		return Instruction{}, fmt.Errorf("invalid instruction %v at %v", instrCode, address)
+	}
+
+	opcode := instrCode % 100
+	info := s.lookup(opcode)
+	if info == nil {
+		return Instruction{}, fmt.Errorf("unknown opcode %v at %v", opcode, address)
+	}
+	if size >= 0 && address+len(info.Params) >= size {
+		return Instruction{}, fmt.Errorf("truncated instruction at %v", address)
+	}
+
+	inst := Instruction{
+		Address: address,
+		Opcode:  opcode,
+		Modes:   make([]int, len(info.Params)),
+		Params:  make([]int, len(info.Params)),
+		op:      info,
+	}
+	modes := instrCode / 100
+	for i := range inst.Modes {
+		inst.Modes[i] = modes % 10
+		modes /= 10
+		if inst.Modes[i] > relativeMode {
+			return Instruction{}, fmt.Errorf("invalid mode %v for parameter %v at %v", inst.Modes[i], i+1, address)
+		}
+		if info.Params[i] == Write && inst.Modes[i] == immediateMode {
+			return Instruction{}, fmt.Errorf("immediate destination at %v", address)
+		}
+		inst.Params[i] = fetch(address + i + 1)
+	}
+	if modes != 0 {
+		return Instruction{}, fmt.Errorf("too many parameter modes in %v at %v", instrCode, address)
+	}
+	return inst, nil
+}
+
+// Disassembly is the result of the analysis of a memory dump
+type Disassembly struct {
+	memory []int
+	// instructions indexed by their address
+	code map[int]Instruction
+	// cells owned by an instruction
+	owned  []bool
+	labels map[int]string
+	set    *InstructionSet
+}
+
+// Disassemble tells code from data, starting at address 0
+// and following jumps whose target is known
+func Disassemble(memory []int) *Disassembly {
+	return builtins.Disassemble(memory)
+}
+
+// Disassemble tells code from data with the opcodes of s
+func (s *InstructionSet) Disassemble(memory []int) *Disassembly {
+	d := &Disassembly{
+		set:    s,
+		memory: memory,
+		code:   make(map[int]Instruction),
+		owned:  make([]bool, len(memory)),
+		labels: make(map[int]string),
+	}
+
+	// return addresses pushed on the stack are explored only once
+	// everything reachable by jumps is known
+	candidates := d.walk([]int{0})
+	for len(candidates) > 0 {
+		candidates = d.walk(candidates)
+	}
+
+	// a label in the middle of an instruction can't be written in a listing
+	for address := range d.labels {
+		if _, ok := d.code[address]; d.owned[address] && !ok {
+			delete(d.labels, address)
+		}
+	}
+	return d
+}
+
+// walk decodes every instruction reachable from starts and returns
+// the possible return addresses found on the way
+func (d *Disassembly) walk(starts []int) []int {
+	var candidates []int
+	todo := starts
+	for len(todo) > 0 {
+		address := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		if _, known := d.code[address]; known {
+			continue
+		}
+		inst, err := d.set.Decode(d.memory, address)
+		if err != nil || d.overlaps(inst) {
+			continue
+		}
+
+		d.code[address] = inst
+		for i := 0; i < inst.Len(); i++ {
+			d.owned[address+i] = true
+		}
+
+		if target, ok := inst.JumpTarget(); ok && target >= 0 && target < len(d.memory) {
+			d.labels[target] = fmt.Sprintf("L%04d", target)
+			todo = append(todo, target)
+		}
+		if ret, ok := pushedAddress(inst); ok && ret >= 0 && ret < len(d.memory) {
+			candidates = append(candidates, ret)
+		}
+		if inst.FallsThrough() {
+			todo = append(todo, address+inst.Len())
+		}
+	}
+
+	// only keep candidates not already decoded
+	result := candidates[:0]
+	for _, c := range candidates {
+		if !d.owned[c] {
+			d.labels[c] = fmt.Sprintf("L%04d", c)
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (d *Disassembly) overlaps(inst Instruction) bool {
+	for i := 0; i < inst.Len(); i++ {
+		if d.owned[inst.Address+i] {
+			return true
+		}
+	}
+	return false
+}
+
+// pushedAddress detects a constant copied on the relative stack
+// like "ADD #ret, #0 -> [rb+0]", usually a return address
+func pushedAddress(inst Instruction) (int, bool) {
+	if inst.Opcode != 1 && inst.Opcode != 2 || inst.Modes[2] != relativeMode {
+		return 0, false
+	}
+	if inst.Modes[0] != immediateMode || inst.Modes[1] != immediateMode {
+		return 0, false
+	}
+	neutral := 0
+	if inst.Opcode == 2 {
+		neutral = 1
+	}
+	switch {
+	case inst.Params[1] == neutral:
+		return inst.Params[0], true
+	case inst.Params[0] == neutral:
+		return inst.Params[1], true
+	}
+	return 0, false
+}
+
+// IsCode informs if address holds the beginning of an instruction
+func (d *Disassembly) IsCode(address int) bool {
+	_, ok := d.code[address]
+	return ok
+}
+
+// Label returns the label of address, if any
+func (d *Disassembly) Label(address int) (string, bool) {
+	label, ok := d.labels[address]
+	return label, ok
+}
+
+// Labels returns the addresses of all labels in ascending order
+func (d *Disassembly) Labels() []int {
+	result := make([]int, 0, len(d.labels))
+	for address := range d.labels {
+		result = append(result, address)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// WriteListing writes the annotated listing
+func (d *Disassembly) WriteListing(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	const dataPerLine = 8
+
+	for address := 0; address < len(d.memory); {
+		if label, ok := d.labels[address]; ok {
+			fmt.Fprintf(bw, "%v:\n", label)
+		}
+
+		if inst, ok := d.code[address]; ok {
+			fmt.Fprintf(bw, "%04d: %v\n", address, inst.format(d.labels))
+			address += inst.Len()
+			continue
+		}
+
+		// group data until next instruction or label
+		end := address + 1
+		for end < len(d.memory) && end-address < dataPerLine && !d.owned[end] {
+			if _, ok := d.labels[end]; ok {
+				break
+			}
+			end++
+		}
+		values := make([]string, 0, end-address)
+		for _, v := range d.memory[address:end] {
+			values = append(values, strconv.Itoa(v))
+		}
+		fmt.Fprintf(bw, "%04d: .data %v\n", address, strings.Join(values, ", "))
+		address = end
+	}
+
+	// bufio.Writer keeps the first error met
+	return bw.Flush()
+}
+
+// Disassemble writes the listing of the program memory
+func (p *Program) Disassemble(w io.Writer) error {
+	return p.instructions.Disassemble(p.MemorySlice(0, p.programLen)).WriteListing(w)
+}
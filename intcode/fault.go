@@ -0,0 +1,75 @@
+package intcode
+
+import "fmt"
+
+// FaultKind classifies the runtime errors of the VM
+type FaultKind int
+
+const (
+	// UnknownOpcode is an instruction whose opcode is not supported
+	UnknownOpcode FaultKind = iota + 1
+	// InvalidMode is a parameter mode other than 0, 1 or 2
+	InvalidMode
+	// ImmediateDestination is a written parameter in immediate mode
+	ImmediateDestination
+	// NegativeAddress is an access to memory, or a jump, below address 0
+	NegativeAddress
+	// Overflow is a value which doesn't fit in an int, see WithArithmetic
+	Overflow
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case UnknownOpcode:
+		return "unknown opcode"
+	case InvalidMode:
+		return "invalid parameter mode"
+	case ImmediateDestination:
+		return "immediate destination"
+	case NegativeAddress:
+		return "negative address"
+	case Overflow:
+		return "overflow"
+	default:
+		return fmt.Sprintf("fault(%d)", int(k))
+	}
+}
+
+// Fault is a runtime error of the VM located in the program
+type Fault struct {
+	Kind FaultKind
+	// IP is the address of the faulting instruction
+	IP int
+	// Instruction is the raw instruction, opcode and modes
+	Instruction int
+	Opcode      int
+	// Param is the faulting parameter starting at 1, 0 if none
+	Param int
+	// Mode is the mode of the faulting parameter
+	Mode int
+	// Address is the offending address, if any
+	Address int
+}
+
+func (f *Fault) Error() string {
+	switch f.Kind {
+	case UnknownOpcode:
+		return fmt.Sprintf("%v %v at ip %v (instruction %v)", f.Kind, f.Opcode, f.IP, f.Instruction)
+	case InvalidMode:
+		return fmt.Sprintf("%v %v for parameter %v at ip %v (instruction %v)", f.Kind, f.Mode, f.Param, f.IP, f.Instruction)
+	case ImmediateDestination:
+		return fmt.Sprintf("%v for parameter %v at ip %v (instruction %v)", f.Kind, f.Param, f.IP, f.Instruction)
+	case NegativeAddress:
+		if f.Param == 0 {
+			return fmt.Sprintf("%v: jump to %v", f.Kind, f.IP)
+		}
+		return fmt.Sprintf("%v %v for parameter %v at ip %v (instruction %v)", f.Kind, f.Address, f.Param, f.IP, f.Instruction)
+	case Overflow:
+		if f.Param == 0 {
+			return fmt.Sprintf("%v of the result at ip %v (instruction %v)", f.Kind, f.IP, f.Instruction)
+		}
+		return fmt.Sprintf("%v of parameter %v at ip %v (instruction %v)", f.Kind, f.Param, f.IP, f.Instruction)
+	default:
+		return fmt.Sprintf("%v at ip %v (instruction %v)", f.Kind, f.IP, f.Instruction)
+	}
+}
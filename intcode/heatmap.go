@@ -0,0 +1,239 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"sort"
+
+	col "github.com/fatih/color"
+)
+
+// HeatMap counts the accesses of a Program to each memory cell
+// cells both written and executed are self-modifying code
+type HeatMap struct {
+	// Reads and Writes count memory accesses of parameters by address
+	Reads  map[int]int
+	Writes map[int]int
+	// Executions count the instructions executed over each cell, parameters included
+	Executions map[int]int
+	Steps      int
+
+	// Live receives a new rendering of the map every Every instructions, when set
+	Live  io.Writer
+	Every int
+	// Width is the number of cells by row, 64 if not positive
+	Width int
+
+	programLen int
+	pending    profileAccess
+}
+
+// NewHeatMap creates an empty heat map
+func NewHeatMap() *HeatMap {
+	return &HeatMap{
+		Reads:      make(map[int]int),
+		Writes:     make(map[int]int),
+		Executions: make(map[int]int),
+	}
+}
+
+// SetHeatMap attaches a heat map to the program, nil detaches it
+func (p *Program) SetHeatMap(h *HeatMap) {
+	p.heatmap = h
+	if h != nil {
+		h.programLen = p.programLen
+	}
+}
+
+// before looks at the memory accessed by the next instruction
+func (h *HeatMap) before(p *Program) bool {
+	return h.pending.look(p)
+}
+
+// after counts the accesses once the instruction is executed
+func (h *HeatMap) after() error {
+	access := &h.pending
+	h.Steps++
+	for address := access.ip; address <= access.ip+len(access.op.Params); address++ {
+		h.Executions[address]++
+	}
+	for _, address := range access.reads[:access.nreads] {
+		h.Reads[address]++
+	}
+	if access.write >= 0 {
+		h.Writes[access.write]++
+	}
+	if h.Live != nil && h.Every > 0 && h.Steps%h.Every == 0 {
+		// move the cursor home and clear the screen so the map is redrawn in place
+		if _, err := io.WriteString(h.Live, "\033[H\033[2J"); err != nil {
+			return err
+		}
+		return h.Render(h.Live)
+	}
+	return nil
+}
+
+// heatKind is the strongest access to a cell
+type heatKind int
+
+const (
+	untouched heatKind = iota
+	read
+	written
+	executed
+	selfModified
+)
+
+// kind classifies the accesses to address
+func (h *HeatMap) kind(address int) heatKind {
+	switch {
+	case h.Writes[address] > 0 && h.Executions[address] > 0:
+		return selfModified
+	case h.Executions[address] > 0:
+		return executed
+	case h.Writes[address] > 0:
+		return written
+	case h.Reads[address] > 0:
+		return read
+	default:
+		return untouched
+	}
+}
+
+// level is the order of magnitude of the accesses to address, from 0 to 5
+func (h *HeatMap) level(address int) int {
+	count := h.Reads[address] + h.Writes[address] + h.Executions[address]
+	level := 0
+	for count > 0 && level < 5 {
+		level++
+		count /= 10
+	}
+	return level
+}
+
+func (h *HeatMap) width() int {
+	if h.Width > 0 {
+		return h.Width
+	}
+	return 64
+}
+
+// rows returns the address of the first cell of each row to draw:
+// every row of the program, then the rows of extra memory accessed,
+// -1 stands for a gap between rows which are not contiguous
+func (h *HeatMap) rows() []int {
+	width := h.width()
+	var rows []int
+	for start := 0; start < h.programLen; start += width {
+		rows = append(rows, start)
+	}
+
+	extra := make(map[int]bool)
+	for _, m := range []map[int]int{h.Reads, h.Writes, h.Executions} {
+		for address := range m {
+			start := address - address%width
+			if len(rows) == 0 || start > rows[len(rows)-1] {
+				extra[start] = true
+			}
+		}
+	}
+	starts := make([]int, 0, len(extra))
+	for start := range extra {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	for _, start := range starts {
+		if len(rows) > 0 && start != rows[len(rows)-1]+width {
+			rows = append(rows, -1)
+		}
+		rows = append(rows, start)
+	}
+	return rows
+}
+
+var (
+	heatColors = map[heatKind]*col.Color{
+		read:         col.New(col.FgCyan),
+		written:      col.New(col.FgYellow),
+		executed:     col.New(col.FgRed),
+		selfModified: col.New(col.FgBlack, col.BgMagenta),
+	}
+	// heatLevels draws the order of magnitude of the accesses
+	heatLevels = []string{".", "1", "2", "3", "4", "5"}
+)
+
+// Render writes the map as coloured text, one character per cell:
+// cyan cells are read, yellow written, red executed and magenta both written
+// and executed, the digit is the order of magnitude of the accesses
+func (h *HeatMap) Render(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	width := h.width()
+	for _, start := range h.rows() {
+		if start < 0 {
+			fmt.Fprintln(bw, "   ...")
+			continue
+		}
+		fmt.Fprintf(bw, "%6d ", start)
+		for address := start; address < start+width; address++ {
+			cell := heatLevels[h.level(address)]
+			if c, found := heatColors[h.kind(address)]; found {
+				cell = c.Sprint(cell)
+			}
+			bw.WriteString(cell)
+		}
+		bw.WriteString("\n")
+	}
+	fmt.Fprintf(bw, "steps: %v, %v=read %v=written %v=executed %v=self-modified\n", h.Steps,
+		heatColors[read].Sprint("1"), heatColors[written].Sprint("1"),
+		heatColors[executed].Sprint("1"), heatColors[selfModified].Sprint("1"))
+	return bw.Flush()
+}
+
+// heatRGB are the colours of the PNG, at the highest level
+var heatRGB = map[heatKind]color.RGBA{
+	read:         {0, 255, 255, 255},
+	written:      {255, 255, 0, 255},
+	executed:     {255, 0, 0, 255},
+	selfModified: {255, 0, 255, 255},
+}
+
+// WritePNG writes the map as a PNG image with scale pixels by cell
+// colours are the ones of Render, brighter when the accesses are more frequent,
+// gaps between rows are grey lines
+func (h *HeatMap) WritePNG(w io.Writer, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+	width := h.width()
+	rows := h.rows()
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, len(rows)*scale))
+
+	for y, start := range rows {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{24, 24, 24, 255}
+			if start < 0 {
+				c = color.RGBA{96, 96, 96, 255}
+			} else if max, found := heatRGB[h.kind(start+x)]; found {
+				// from a third to the full colour
+				level := h.level(start + x)
+				c = color.RGBA{shade(max.R, level), shade(max.G, level), shade(max.B, level), 255}
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetRGBA(x*scale+dx, y*scale+dy, c)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// shade scales a colour component to the level of accesses, from 1 to 5
+func shade(max uint8, level int) uint8 {
+	return uint8(int(max) * (level + 1) / 6)
+}
@@ -0,0 +1,66 @@
+package intcode
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeatMap(t *testing.T) {
+	// patches its second output into a halt, and writes out of the program
+	program := []int{1001, 14, 85, 10, 1101, 1, 1, 100, 104, 7, 104, 8, 99, 0, 14}
+	h := NewHeatMap()
+	h.Width = 8
+	var live bytes.Buffer
+	h.Live, h.Every = &live, 2
+	p := ProgramCreator(program)()
+	p.SetHeatMap(h)
+	if err := p.RunIO(nil, nil, &SliceOutput{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Steps != 4 {
+		t.Errorf("got %v steps, want 4", h.Steps)
+	}
+	for _, test := range []struct {
+		address int
+		want    heatKind
+	}{
+		{0, executed},
+		{10, selfModified},
+		{12, untouched},
+		{14, read},
+		{100, written},
+	} {
+		if got := h.kind(test.address); got != test.want {
+			t.Errorf("address %v: got %v, want %v", test.address, got, test.want)
+		}
+	}
+	// the rows of the program, a gap, then the row of address 100
+	if got := h.rows(); !reflect.DeepEqual(got, []int{0, 8, -1, 96}) {
+		t.Errorf("got rows %v, want [0 8 -1 96]", got)
+	}
+	if got := strings.Count(live.String(), "\033[H\033[2J"); got != 2 {
+		t.Errorf("got %v live renderings, want 2", got)
+	}
+
+	var b bytes.Buffer
+	if err := h.WritePNG(&b, 3); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 24 || size.Y != 12 {
+		t.Fatalf("got a %vx%v image, want 24x12", size.X, size.Y)
+	}
+	// address 10 is the third cell of the second row, accessed less than 10 times
+	want := color.RGBA{85, 0, 85, 255}
+	if got := color.RGBAModel.Convert(img.At(2*3+1, 1*3+1)); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,324 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrNoHistory is returned when going backwards without a History attached
+var ErrNoHistory = errors.New("no history attached to the program")
+
+// ErrHistoryExhausted is returned when going back further than the history allows
+var ErrHistoryExhausted = errors.New("not enough history to go back")
+
+// undoEntry is what is needed to undo an instruction
+type undoEntry struct {
+	ip, rb int
+	// address is the cell written, -1 if none, and old its previous value
+	// oldBig is set when the previous value doesn't fit in an int
+	address, old int
+	oldBig       *big.Int
+	// more are the cells written after the first one, by custom opcodes
+	more []cellWrite
+	// read is set when the instruction read input, wrote when it wrote an output
+	read, wrote bool
+	input       int
+}
+
+// writes tells if the instruction of e wrote the cell at address
+func (e *undoEntry) writes(address int) bool {
+	if e.address == address {
+		return true
+	}
+	for _, w := range e.more {
+		if w.address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// cellWrite is the previous value of a memory cell
+type cellWrite struct {
+	address, old int
+	oldBig       *big.Int
+}
+
+// checkpoint is the state of the program at a given step
+type checkpoint struct {
+	step     int
+	snapshot *Snapshot
+}
+
+// History records the execution of a program so it can be executed backwards
+//
+// The last instructions are undone with a log of the registers and the
+// memory cell each of them changed. To go further back, the program is
+// restored from a periodic snapshot and executed forward again with the
+// inputs it consumed. Outputs undone are dropped if they were not delivered
+// yet, and tools attached to the program, like a tracer, are not rewound.
+type History struct {
+	window      int
+	checkpoints int
+
+	// step is the number of instructions executed since the history is attached
+	step    int
+	current undoEntry
+	// log holds the entries of the instructions from logStart to step
+	log      []undoEntry
+	logStart int
+	saved    []checkpoint
+	// events are the values read and written since the oldest checkpoint
+	events []IOEvent
+}
+
+// NewHistory creates a history undoing the last window instructions with its log,
+// a non positive window keeps the whole log
+// if checkpoints is positive, a snapshot is also taken every window instructions
+// and the last ones are kept, so the program can go back up to checkpoints*window instructions
+func NewHistory(window, checkpoints int) *History {
+	return &History{window: window, checkpoints: checkpoints}
+}
+
+// SetHistory attaches a history to the program, nil detaches it
+// the history starts at the current state of the program
+func (p *Program) SetHistory(h *History) {
+	p.history = h
+	if h != nil {
+		h.step, h.logStart = 0, 0
+		h.log, h.saved, h.events = nil, nil, nil
+		h.checkpoint(p)
+	}
+}
+
+// History returns the history attached to the program, nil if none
+func (p *Program) History() *History {
+	return p.history
+}
+
+// Step is the number of instructions executed since the history is attached
+func (h *History) Step() int {
+	return h.step
+}
+
+// Oldest is the first step the program can go back to
+func (h *History) Oldest() int {
+	if len(h.saved) > 0 {
+		return h.saved[0].step
+	}
+	return h.logStart
+}
+
+// before starts the entry of the instruction about to be executed
+func (h *History) before(p *Program) {
+	h.current = undoEntry{ip: p.instrPtr, rb: p.relativeBase, address: -1}
+}
+
+// written keeps the value of address before the instruction writes it
+func (h *History) written(address, old int, oldBig *big.Int) {
+	if h.current.address >= 0 {
+		h.current.more = append(h.current.more, cellWrite{address, old, oldBig})
+		return
+	}
+	h.current.address = address
+	h.current.old = old
+	h.current.oldBig = oldBig
+}
+
+// exchanged keeps the values read and written to execute the program again
+func (h *History) exchanged(kind EventKind, v int) {
+	if kind == InputEvent {
+		h.current.read = true
+		h.current.input = v
+	} else {
+		h.current.wrote = true
+	}
+	if h.checkpoints > 0 {
+		h.events = append(h.events, IOEvent{Step: h.step, Kind: kind, Value: v})
+	}
+}
+
+// after logs the entry of the instruction once executed
+func (h *History) after(p *Program) {
+	h.log = append(h.log, h.current)
+	h.step++
+
+	// the log is trimmed by chunks so it is not copied at every instruction
+	if h.window > 0 && len(h.log) > 2*h.window {
+		drop := len(h.log) - h.window
+		h.log = append([]undoEntry(nil), h.log[drop:]...)
+		h.logStart += drop
+	}
+	if h.window > 0 && h.step%h.window == 0 {
+		h.checkpoint(p)
+	}
+}
+
+// checkpoint saves the state of the program, dropping the oldest checkpoint if needed
+func (h *History) checkpoint(p *Program) {
+	if h.checkpoints <= 0 {
+		return
+	}
+	h.saved = append(h.saved, checkpoint{step: h.step, snapshot: p.Snapshot()})
+	if len(h.saved) > h.checkpoints {
+		h.saved = h.saved[1:]
+		oldest := h.saved[0].step
+		i := 0
+		for i < len(h.events) && h.events[i].Step < oldest {
+			i++
+		}
+		h.events = h.events[i:]
+	}
+}
+
+// StepBack undoes the last n instructions
+func (p *Program) StepBack(n int) error {
+	if p.history == nil {
+		return ErrNoHistory
+	}
+	if n > p.history.step {
+		return ErrHistoryExhausted
+	}
+	return p.RewindTo(p.history.step - n)
+}
+
+// RewindTo puts the program back in its state after step instructions
+// it must not be called while the program runs
+func (p *Program) RewindTo(step int) error {
+	h := p.history
+	if h == nil {
+		return ErrNoHistory
+	}
+	if step < 0 || step > h.step {
+		return fmt.Errorf("invalid step %v, the program is at step %v", step, h.step)
+	}
+	if step >= h.logStart {
+		p.undo(h.step - step)
+		return nil
+	}
+	return p.replayFrom(step)
+}
+
+// RewindToLastWrite puts the program back in its state before the last
+// instruction writing address, as long as it is in the log
+// it returns the address of this instruction
+func (p *Program) RewindToLastWrite(address int) (int, error) {
+	h := p.history
+	if h == nil {
+		return 0, ErrNoHistory
+	}
+	for i := len(h.log) - 1; i >= 0; i-- {
+		if h.log[i].writes(address) {
+			p.undo(len(h.log) - i)
+			return p.instrPtr, nil
+		}
+	}
+	return 0, fmt.Errorf("no write at %v in the last %v instructions", address, len(h.log))
+}
+
+// undo executes backwards the last n logged instructions
+func (p *Program) undo(n int) {
+	h := p.history
+	for i := 0; i < n; i++ {
+		e := h.log[len(h.log)-1]
+		h.log = h.log[:len(h.log)-1]
+		h.step--
+
+		if e.read {
+			// the value will be read again
+			p.pendingInput = append([]int{e.input}, p.pendingInput...)
+		}
+		if e.wrote && len(p.pendingOutput) > 0 {
+			p.pendingOutput = p.pendingOutput[:len(p.pendingOutput)-1]
+		}
+		for j := len(e.more) - 1; j >= 0; j-- {
+			p.mem.set(e.more[j].address, e.more[j].old)
+			p.setBig(e.more[j].address, e.more[j].oldBig)
+		}
+		if e.address >= 0 {
+			p.mem.set(e.address, e.old)
+			p.setBig(e.address, e.oldBig)
+		}
+		p.instrPtr, p.relativeBase = e.ip, e.rb
+		p.halted = false
+	}
+	h.forget()
+}
+
+// forget drops what was recorded after the current step,
+// the program may not execute the same way from now on
+func (h *History) forget() {
+	i := len(h.events)
+	for i > 0 && h.events[i-1].Step >= h.step {
+		i--
+	}
+	h.events = h.events[:i]
+
+	i = len(h.saved)
+	for i > 0 && h.saved[i-1].step > h.step {
+		i--
+	}
+	h.saved = h.saved[:i]
+}
+
+// replayFrom restores the last checkpoint before step and executes the program
+// forward to step, with the inputs it consumed
+func (p *Program) replayFrom(step int) error {
+	h := p.history
+	i := len(h.saved) - 1
+	for i >= 0 && h.saved[i].step > step {
+		i--
+	}
+	if i < 0 {
+		return ErrHistoryExhausted
+	}
+	c := h.saved[i]
+
+	// inputs read from the checkpoint come first, then the ones to read again,
+	// outputs written after step are taken back
+	var inputs []int
+	written := 0
+	for _, e := range h.events {
+		switch {
+		case e.Step < c.step:
+		case e.Kind == InputEvent:
+			inputs = append(inputs, e.Value)
+		case e.Kind == OutputEvent && e.Step >= step:
+			written++
+		}
+	}
+	pendingInput := append(inputs, p.pendingInput...)
+	pendingOutput := p.pendingOutput
+	if written > len(pendingOutput) {
+		written = len(pendingOutput)
+	}
+	pendingOutput = pendingOutput[:len(pendingOutput)-written]
+
+	restored := c.snapshot.Restore()
+	p.mem, p.bigCells = restored.mem, restored.bigCells
+	p.instrPtr, p.relativeBase, p.halted = restored.instrPtr, restored.relativeBase, restored.halted
+	p.pendingInput, p.pendingOutput = pendingInput, nil
+
+	h.step = c.step
+	h.log, h.logStart = nil, c.step
+	h.forget()
+
+	// the attached tools already saw these instructions
+	saved := *p
+	p.input, p.output = nil, nil
+	p.tracer, p.profiler, p.heatmap, p.monitor = nil, nil, nil, nil
+	p.limit, p.recorder = nil, nil
+	defer func() {
+		p.input, p.output = saved.input, saved.output
+		p.tracer, p.profiler, p.heatmap, p.monitor = saved.tracer, saved.profiler, saved.heatmap, saved.monitor
+		p.limit, p.recorder = saved.limit, saved.recorder
+	}()
+	for h.step < step {
+		if err := p.ExecuteNextInstruction(); err != nil {
+			return fmt.Errorf("execution from step %v differs: %v", c.step, err)
+		}
+	}
+	p.pendingOutput = pendingOutput
+	return nil
+}
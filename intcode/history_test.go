@@ -0,0 +1,65 @@
+package intcode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStepBack(t *testing.T) {
+	// reads a count and writes count, count-1... 1 from a loop
+	countdown := []int{3, 100, 4, 100, 1001, 100, -1, 100, 1005, 100, 2, 99}
+
+	for _, test := range []struct {
+		name        string
+		program     []int
+		inputs      []int
+		window      int
+		checkpoints int
+	}{
+		{"whole log", countdown, []int{5}, 0, 0},
+		{"checkpoints", countdown, []int{5}, 4, 8},
+		{"quine", []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}, nil, 5, 20},
+	} {
+		// the state after every instruction
+		var states []*Snapshot
+		run := func(p *Program) {
+			for !p.halted {
+				if err := p.ExecuteNextInstruction(); err != nil {
+					t.Fatalf("%v: %v", test.name, err)
+				}
+			}
+		}
+		p := ProgramCreator(test.program)()
+		p.Feed(test.inputs...)
+		states = append(states, p.Snapshot())
+		for !p.halted {
+			if err := p.ExecuteNextInstruction(); err != nil {
+				t.Fatalf("%v: %v", test.name, err)
+			}
+			states = append(states, p.Snapshot())
+		}
+		end := len(states) - 1
+
+		// going back to a step and executing forward again gives the same states
+		for step := end; step >= 0; step-- {
+			p := ProgramCreator(test.program)()
+			p.Feed(test.inputs...)
+			p.SetHistory(NewHistory(test.window, test.checkpoints))
+			run(p)
+			if step < p.History().Oldest() {
+				continue
+			}
+
+			if err := p.StepBack(end - step); err != nil {
+				t.Fatalf("%v, back to %v: %v", test.name, step, err)
+			}
+			if got := p.Snapshot(); !reflect.DeepEqual(got, states[step]) {
+				t.Fatalf("%v, back to %v: got %+v, want %+v", test.name, step, got, states[step])
+			}
+			run(p)
+			if got := p.Snapshot(); !reflect.DeepEqual(got, states[end]) {
+				t.Fatalf("%v, forward from %v: got %+v, want %+v", test.name, step, got, states[end])
+			}
+		}
+	}
+}
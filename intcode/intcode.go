@@ -1,286 +1,566 @@
 package intcode
 
 import (
-	"errors"
+	"adventofcode2019/common"
+	"bufio"
+	"context"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
+// ReadProgram reads the comma-separated intcode program stored in filepath
+func ReadProgram(filepath string) ([]int, error) {
+	f := common.OpenFile(filepath)
+	defer common.CloseFile(f)
+
+	s := bufio.NewScanner(f)
+	// some programs are longer than the default buffer
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	s.Scan()
+
+	parts := strings.Split(strings.TrimSpace(s.Text()), ",")
+	err := s.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	seq := make([]int, 0)
+	for _, elt := range parts {
+		code, err := strconv.Atoi(elt)
+		if err != nil {
+			return nil, err
+		}
+
+		seq = append(seq, code)
+	}
+	return seq, nil
+}
+
+// instrumentations are applied to every program created by ProgramCreator
+var instrumentations []func(*Program)
+
+// Instrument registers f to be called on every program created by ProgramCreator
+// it allows to attach tools like a tracer without changing the callers
+func Instrument(f func(*Program)) {
+	instrumentations = append(instrumentations, f)
+}
+
+// Instrumented tells if functions were registered with Instrument
+// programs should then be created in a deterministic order, from one goroutine
+func Instrumented() bool {
+	return len(instrumentations) > 0
+}
+
 // ProgramCreator allows you to create an instance of Program
-func ProgramCreator(state []int) func() *Program {
+// options, like limits, are applied to every instance
+func ProgramCreator(state []int, options ...Option) func() *Program {
 	// keep the initial sequence safe
 	safeBackup := make([]int, len(state))
 	copy(safeBackup, state)
 
 	return func() *Program {
-		attempt := make([]int, len(safeBackup))
-		copy(attempt, safeBackup)
-		return &Program{program: attempt}
+		p := &Program{mem: newMemory(safeBackup), programLen: len(safeBackup), instructions: builtins}
+		for _, option := range options {
+			option(p)
+		}
+		for _, f := range instrumentations {
+			f(p)
+		}
+		return p
 	}
 }
 
 // Program contains the input data
 type Program struct {
-	program      []int
+	mem memory
+	// programLen is the size of the loaded program, memory beyond is extra memory
+	programLen   int
 	instrPtr     int
-	extraMemory  map[int]int
-	input        chan int
-	output       chan int
+	input        Input
+	output       Output
 	halted       bool
 	relativeBase int
+	tracer       *Tracer
+	profiler     *Profiler
+	heatmap      *HeatMap
+	monitor      Monitor
+	limit        *limits
+	recorder     *Recorder
+	history      *History
+	instructions *InstructionSet
+	arithmetic   Arithmetic
+	// bigCells are the values which don't fit in an int, with BigArithmetic
+	bigCells map[int]*big.Int
+	// args holds the resolved parameters of the current instruction
+	args [maxParams]int
+	// bigArgs are the parameters which don't fit in an int, when there are bigCells
+	bigArgs [maxParams]*big.Int
+	// moved is set when the current instruction changed the instruction pointer
+	moved bool
+	// values read before the input, and written when there is no output
+	pendingInput  []int
+	pendingOutput []int
+	// ctx interrupts the execution when set
+	ctx context.Context
 }
 
 // Run executes the program
 func (p *Program) Run(in, out, quit chan int) error {
+	err := p.RunIO(nil, ChanInput(in), ChanOutput(out))
+	if err != nil {
+		return err
+	}
+	close(out)
+	quit <- 0
+	return nil
+}
+
+// RunContext executes the program until it halts, fails or ctx is done
+// out is closed when it returns, whatever the reason
+func (p *Program) RunContext(ctx context.Context, in <-chan int, out chan<- int) error {
+	defer close(out)
+	return p.RunIO(ctx, &chanInput{ch: in, ctx: ctx}, &chanOutput{ch: out, ctx: ctx})
+}
+
+// Start executes the program in a new goroutine with RunContext
+// the returned channel receives the terminal error (nil if halted) then is closed
+func (p *Program) Start(ctx context.Context, in <-chan int, out chan<- int) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- p.RunContext(ctx, in, out)
+		close(done)
+	}()
+	return done
+}
+
+// RunIO executes the program with in and out until it halts, fails or ctx is done
+// ctx may be nil if the execution can't be cancelled
+func (p *Program) RunIO(ctx context.Context, in Input, out Output) error {
+	if p.limit != nil && p.limit.timeout > 0 {
+		// the time limit also interrupts the program while it waits for IO
+		limited, cancel := p.limit.withDeadline(ctx)
+		defer cancel()
+		err := p.runIO(limited, inputWithContext(limited, in), outputWithContext(limited, out))
+		return p.limit.checkDeadline(ctx, err, p.instrPtr)
+	}
+	return p.runIO(ctx, in, out)
+}
+
+func (p *Program) runIO(ctx context.Context, in Input, out Output) error {
 	p.input = in
 	p.output = out
+	p.ctx = ctx
+	defer func() { p.ctx = nil }()
+
+	for len(p.pendingOutput) > 0 && p.output != nil {
+		if err := p.output.Write(p.pendingOutput[0]); err != nil {
+			return err
+		}
+		p.pendingOutput = p.pendingOutput[1:]
+	}
 
-	for !p.halted {
+	for steps := 0; !p.halted; steps++ {
+		// a program may loop without any IO, check for cancellation regularly
+		if p.ctx != nil && steps%1024 == 0 {
+			if err := p.ctx.Err(); err != nil {
+				return err
+			}
+		}
 		err := p.ExecuteNextInstruction()
 		if err != nil {
 			return err
 		}
 	}
-	quit <- 0
 	return nil
 }
 
-// MemorySlice returns a slice of memory
-// mixing program and extraMemory storage
+// receive reads the next input, fed values come first
+func (p *Program) receive() (int, error) {
+	if len(p.pendingInput) > 0 {
+		v := p.pendingInput[0]
+		p.pendingInput = p.pendingInput[1:]
+		return v, nil
+	}
+	if p.input == nil {
+		return 0, ErrNoInput
+	}
+	return p.input.Read()
+}
+
+// ReadInput reads the next input of the program
+// it is meant to be called by opcode handlers, before any change
+func (p *Program) ReadInput() (int, error) {
+	v, err := p.receive()
+	if err != nil {
+		return 0, err
+	}
+	if p.recorder != nil {
+		if err := p.recorder.record(InputEvent, v); err != nil {
+			return 0, err
+		}
+	}
+	if p.history != nil {
+		p.history.exchanged(InputEvent, v)
+	}
+	if p.profiler != nil {
+		p.profiler.Inputs++
+	}
+	if p.monitor != nil {
+		p.monitor.Exchanged(p, InputEvent, v)
+	}
+	return v, nil
+}
+
+// WriteOutput writes an output of the program
+// without output, the value is queued for Resume
+// it is meant to be called by opcode handlers, before any change
+func (p *Program) WriteOutput(v int) error {
+	if p.limit != nil {
+		if err := p.limit.checkOutput(p.instrPtr); err != nil {
+			return err
+		}
+	}
+	if p.recorder != nil {
+		if err := p.recorder.record(OutputEvent, v); err != nil {
+			return err
+		}
+	}
+	if p.output == nil {
+		p.pendingOutput = append(p.pendingOutput, v)
+	} else if err := p.output.Write(v); err != nil {
+		return err
+	}
+	if p.limit != nil {
+		p.limit.outputs++
+	}
+	if p.history != nil {
+		p.history.exchanged(OutputEvent, v)
+	}
+	if p.profiler != nil {
+		p.profiler.Outputs++
+	}
+	if p.monitor != nil {
+		p.monitor.Exchanged(p, OutputEvent, v)
+	}
+	return nil
+}
+
+// Store writes v at dest for the current instruction
+// unlike SetMemory, the write can be undone by a History
+// it is meant to be called by opcode handlers
+func (p *Program) Store(dest, v int) {
+	if p.history != nil {
+		p.history.written(dest, p.mem.at(dest), p.bigCells[dest])
+	}
+	p.mem.set(dest, v)
+	if p.bigCells != nil {
+		delete(p.bigCells, dest)
+	}
+}
+
+// MemorySlice returns a copy of memory between start and end
+// negative addresses read as 0
 func (p *Program) MemorySlice(start, end int) []int {
+	if end < start {
+		return nil
+	}
 	result := make([]int, end-start)
 	for idx := range result {
-		result[idx] = p.MemoryAt(start + idx)
+		result[idx] = p.mem.at(start + idx)
 	}
 	return result
 }
 
 // MemoryAt returns the value at a specific address
-// this allows to retrieve values outside program memory space
+// this allows to retrieve values outside program memory space, a negative address reads 0
 func (p *Program) MemoryAt(address int) int {
-	if address < len(p.program) {
-		return p.program[address]
-	}
-	return p.extraMemory[address-len(p.program)]
+	return p.mem.at(address)
 }
 
-// SetMemory allows to set a value at address mixing program and extraMemory
+// SetMemory allows to set a value at address, inside or outside program memory space
+// address must not be negative
 func (p *Program) SetMemory(address int, v int) {
-	if address < len(p.program) {
-		p.program[address] = v
-	} else {
-		if p.extraMemory == nil {
-			p.extraMemory = make(map[int]int)
-		}
-		p.extraMemory[address-len(p.program)] = v
+	p.mem.set(address, v)
+	if p.bigCells != nil {
+		delete(p.bigCells, address)
 	}
 }
 
 // IsCompleted informs about the completeness of the program
 func (p *Program) IsCompleted() bool {
-	return p.MemoryAt(p.instrPtr) == 99
+	return p.halted || p.MemoryAt(p.instrPtr) == 99
 }
 
 // ExecuteNextInstruction identifies instruction to execute and do it
 func (p *Program) ExecuteNextInstruction() error {
-	instrCode := p.MemoryAt(p.instrPtr)
-	opcode := instrCode % 100
-	switch opcode {
-	case 1:
-		p.ExecuteAdd()
-	case 2:
-		p.ExecuteMultiply()
-	case 3:
-		p.ExecuteInput()
-	case 4:
-		p.ExecuteOutput()
-	case 5:
-		p.ExecuteJumpIfTrue()
-	case 6:
-		p.ExecuteJumpIfFalse()
-	case 7:
-		p.ExecuteLessThan()
-	case 8:
-		p.ExecuteEquals()
-	case 9:
-		p.ExecuteRelativeBaseOffset()
-	case 99:
-		close(p.output)
-		p.halted = true
-	default:
-		return errors.New("unknown opcode: " + strconv.Itoa(opcode))
+	if p.instrPtr < 0 {
+		return &Fault{Kind: NegativeAddress, IP: p.instrPtr, Address: p.instrPtr}
+	}
+	if p.monitor != nil {
+		if err := p.monitor.Before(p); err != nil {
+			return err
+		}
+	}
+	if p.limit != nil {
+		if err := p.limit.checkStep(p.instrPtr); err != nil {
+			return err
+		}
 	}
-	return nil
-}
 
-// ExecuteRelativeBaseOffset adjusts the relative base
-func (p *Program) ExecuteRelativeBaseOffset() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+2)
-	paramModes := getParamModes(inst[0])
+	var entry *TraceEntry
+	if p.tracer != nil {
+		entry = p.tracer.before(p)
+	}
+
+	profiled := p.profiler != nil && p.profiler.before(p)
+	heated := p.heatmap != nil && p.heatmap.before(p)
 
-	firstParam := p.resolveParam(0, inst, paramModes)
+	if p.recorder != nil {
+		if err := p.recorder.before(p); err != nil {
+			return err
+		}
+	}
+	if p.history != nil {
+		p.history.before(p)
+	}
 
-	p.relativeBase += firstParam
+	instrCode := p.mem.at(p.instrPtr)
+	op := p.instructions.lookup(instrCode % 100)
+	if op == nil {
+		return &Fault{Kind: UnknownOpcode, IP: p.instrPtr, Instruction: instrCode, Opcode: instrCode % 100}
+	}
+	if err := p.execute(op, instrCode); err != nil {
+		return err
+	}
 
-	p.instrPtr += 2
+	if p.limit != nil {
+		p.limit.steps++
+	}
+	if p.recorder != nil {
+		p.recorder.steps++
+	}
+	if p.history != nil {
+		p.history.after(p)
+	}
+	if profiled {
+		p.profiler.after()
+	}
+	if heated {
+		if err := p.heatmap.after(); err != nil {
+			return err
+		}
+	}
+	if p.tracer != nil {
+		return p.tracer.after(p, entry)
+	}
+	return nil
 }
 
-// ExecuteEquals stores 1 in third if first == second else 0
-func (p *Program) ExecuteEquals() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+4)
-	paramModes := getParamModes(inst[0])
-
-	firstParam := p.resolveParam(0, inst, paramModes)
-	secondParam := p.resolveParam(1, inst, paramModes)
-	dest := p.resolveDestination(2, inst, paramModes)
+// execute runs the handler of op with the parameters of the instruction at the
+// instruction pointer, and moves to the next instruction unless it jumped
+func (p *Program) execute(op *Opcode, instrCode int) error {
+	args := p.args[:len(op.Params)]
+	for i, role := range op.Params {
+		var err error
+		if role == Write {
+			args[i], err = p.resolveDestination(i, instrCode)
+		} else {
+			args[i], err = p.resolveParam(i, instrCode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if p.bigCells != nil && !op.big {
+		for i, role := range op.Params {
+			if role == Read && p.bigArgs[i] != nil {
+				return p.overflow(i)
+			}
+		}
+	}
 
-	if firstParam == secondParam {
-		p.SetMemory(dest, 1)
-	} else {
-		p.SetMemory(dest, 0)
+	p.moved = false
+	if err := op.Handler(p, args); err != nil {
+		return err
 	}
+	if !p.moved {
+		p.instrPtr += len(args) + 1
+	}
+	return nil
+}
 
-	p.instrPtr += 4
+// executeAs executes the instruction at the instruction pointer as the opcode
+// code of the instruction set, whatever its own opcode, without the attached tools
+func (p *Program) executeAs(code int) error {
+	op := p.instructions.lookup(code)
+	if op == nil {
+		return &Fault{Kind: UnknownOpcode, IP: p.instrPtr, Instruction: p.mem.at(p.instrPtr), Opcode: code}
+	}
+	return p.execute(op, p.mem.at(p.instrPtr))
 }
 
-// ExecuteLessThan stores 1 in third if first < second else 0
-func (p *Program) ExecuteLessThan() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+4)
-	paramModes := getParamModes(inst[0])
+// ExecuteAdd handles addition opcode
+func (p *Program) ExecuteAdd() error {
+	return p.executeAs(1)
+}
 
-	firstParam := p.resolveParam(0, inst, paramModes)
-	secondParam := p.resolveParam(1, inst, paramModes)
-	dest := p.resolveDestination(2, inst, paramModes)
+// ExecuteMultiply handles multiplication opcode
+func (p *Program) ExecuteMultiply() error {
+	return p.executeAs(2)
+}
 
-	if firstParam < secondParam {
-		p.SetMemory(dest, 1)
-	} else {
-		p.SetMemory(dest, 0)
-	}
+// ExecuteInput simulate a "read" and insert input at the address coming next
+// the instruction is not executed if reading the input fails
+func (p *Program) ExecuteInput() error {
+	return p.executeAs(3)
+}
 
-	p.instrPtr += 4
+// ExecuteOutput simulate a print
+// the instruction is not executed if sending the output fails
+func (p *Program) ExecuteOutput() error {
+	return p.executeAs(4)
 }
 
 // ExecuteJumpIfTrue jump to firstParam if non-zero
-func (p *Program) ExecuteJumpIfTrue() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+3)
-	paramModes := getParamModes(inst[0])
-
-	firstParam := p.resolveParam(0, inst, paramModes)
-	secondParam := p.resolveParam(1, inst, paramModes)
-
-	if firstParam != 0 {
-		p.instrPtr = secondParam
-	} else {
-		p.instrPtr += 3
-	}
+func (p *Program) ExecuteJumpIfTrue() error {
+	return p.executeAs(5)
 }
 
 // ExecuteJumpIfFalse jump to firstParam if zero
-func (p *Program) ExecuteJumpIfFalse() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+3)
-	paramModes := getParamModes(inst[0])
-
-	firstParam := p.resolveParam(0, inst, paramModes)
-	secondParam := p.resolveParam(1, inst, paramModes)
-
-	if firstParam == 0 {
-		p.instrPtr = secondParam
-	} else {
-		p.instrPtr += 3
-	}
+func (p *Program) ExecuteJumpIfFalse() error {
+	return p.executeAs(6)
 }
 
-// ExecuteInput simulate a "read" and insert input at the address coming next
-func (p *Program) ExecuteInput() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+2)
-	paramModes := getParamModes(inst[0])
-
-	dest := p.resolveDestination(0, inst, paramModes)
-
-	p.SetMemory(dest, <-p.input)
-	p.instrPtr += 2
+// ExecuteLessThan stores 1 in third if first < second else 0
+func (p *Program) ExecuteLessThan() error {
+	return p.executeAs(7)
 }
 
-// ExecuteOutput simulate a print
-func (p *Program) ExecuteOutput() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+2)
-	paramModes := getParamModes(inst[0])
+// ExecuteEquals stores 1 in third if first == second else 0
+func (p *Program) ExecuteEquals() error {
+	return p.executeAs(8)
+}
 
-	firstParam := p.resolveParam(0, inst, paramModes)
+// ExecuteRelativeBaseOffset adjusts the relative base
+func (p *Program) ExecuteRelativeBaseOffset() error {
+	return p.executeAs(9)
+}
 
-	p.output <- firstParam
-	p.instrPtr += 2
+// Jump moves the instruction pointer to address once the instruction is executed
+// it is meant to be called by opcode handlers
+func (p *Program) Jump(address int) {
+	p.instrPtr = address
+	p.moved = true
 }
 
-// ExecuteAdd handles addition opcode
-func (p *Program) ExecuteAdd() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+4)
-	paramModes := getParamModes(inst[0])
-
-	firstParam := p.resolveParam(0, inst, paramModes)
-	secondParam := p.resolveParam(1, inst, paramModes)
-	dest := p.resolveDestination(2, inst, paramModes)
-
-	p.SetMemory(dest, firstParam+secondParam)
-	p.instrPtr += 4
-}
-
-func getParamModes(opCodeInstr int) map[int]int {
-	result := make(map[int]int)
-	modeOpCode := strconv.Itoa(opCodeInstr)
-	for i := len(modeOpCode) - 3; i >= 0; i-- {
-		switch modeOpCode[i] {
-		case '0':
-			result[len(modeOpCode)-3-i] = 0
-		case '1':
-			result[len(modeOpCode)-3-i] = 1
-		case '2':
-			result[len(modeOpCode)-3-i] = 2
+// Halt stops the program on the current instruction
+// it is meant to be called by opcode handlers
+func (p *Program) Halt() error {
+	if p.recorder != nil {
+		if err := p.recorder.record(HaltEvent, 0); err != nil {
+			return err
 		}
 	}
-	return result
+	p.halted = true
+	p.moved = true
+	if p.monitor != nil {
+		p.monitor.Exchanged(p, HaltEvent, 0)
+	}
+	return nil
 }
 
-// ExecuteMultiply handles multiplication opcode
-func (p *Program) ExecuteMultiply() {
-	inst := p.MemorySlice(p.instrPtr, p.instrPtr+4)
-	paramModes := getParamModes(inst[0])
-
-	firstParam := p.resolveParam(0, inst, paramModes)
-	secondParam := p.resolveParam(1, inst, paramModes)
-	dest := p.resolveDestination(2, inst, paramModes)
+// RelativeBase returns the base of the relative mode
+func (p *Program) RelativeBase() int {
+	return p.relativeBase
+}
 
-	p.SetMemory(dest, firstParam*secondParam)
-	p.instrPtr += 4
+// SetRelativeBase changes the base of the relative mode
+func (p *Program) SetRelativeBase(base int) {
+	p.relativeBase = base
 }
 
-func (p *Program) resolveParam(i int, instruction []int, modes map[int]int) int {
-	mode, found := modes[i]
-	if !found {
-		mode = 0
+// paramMode returns the mode digit of parameter i, valid or not
+// constant divisors keep the decoding cheap once inlined
+func paramMode(instrCode, i int) int {
+	switch i {
+	case 0:
+		return instrCode / 100 % 10
+	case 1:
+		return instrCode / 1000 % 10
+	default:
+		return instrCode / 10000 % 10
 	}
+}
 
-	param := instruction[i+1]
+func (p *Program) resolveParam(i int, instrCode int) (int, error) {
+	mode := paramMode(instrCode, i)
+	cell := p.instrPtr + i + 1
+	param := p.mem.at(cell)
 	switch mode {
-	case 0:
-		// address mode
-		return p.MemoryAt(param)
-	case 1:
-		// immediate mode
-		return param
-	case 2:
-		// relative mode
-		return p.MemoryAt(p.relativeBase + param)
+	case positionMode:
+	case immediateMode:
+		if p.bigCells != nil {
+			p.bigArgs[i] = p.bigCells[cell]
+		}
+		return param, nil
+	case relativeMode:
+		param += p.relativeBase
 	default:
-		// should never happens
-		return 0
+		return 0, p.fault(InvalidMode, i, instrCode, mode, 0)
+	}
+	if p.bigCells != nil {
+		if p.bigCells[cell] != nil {
+			return 0, p.fault(Overflow, i, instrCode, mode, 0)
+		}
+		p.bigArgs[i] = p.bigCells[param]
+	}
+	if param < 0 {
+		return 0, p.fault(NegativeAddress, i, instrCode, mode, param)
+	}
+	if p.limit != nil {
+		if err := p.limit.checkAddress(p.instrPtr, param); err != nil {
+			return 0, err
+		}
 	}
+	return p.mem.at(param), nil
 }
 
-func (p *Program) resolveDestination(i int, instruction []int, modes map[int]int) int {
-	dest := instruction[i+1]
-	if modes[i] == 2 {
+func (p *Program) resolveDestination(i int, instrCode int) (int, error) {
+	mode := paramMode(instrCode, i)
+	cell := p.instrPtr + i + 1
+	dest := p.mem.at(cell)
+	switch mode {
+	case positionMode:
+	case immediateMode:
+		return 0, p.fault(ImmediateDestination, i, instrCode, mode, 0)
+	case relativeMode:
 		dest += p.relativeBase
+	default:
+		return 0, p.fault(InvalidMode, i, instrCode, mode, 0)
+	}
+	if p.bigCells != nil && p.bigCells[cell] != nil {
+		return 0, p.fault(Overflow, i, instrCode, mode, 0)
+	}
+	if dest < 0 {
+		return 0, p.fault(NegativeAddress, i, instrCode, mode, dest)
+	}
+	if p.limit != nil {
+		if err := p.limit.checkAddress(p.instrPtr, dest); err != nil {
+			return 0, err
+		}
+	}
+	return dest, nil
+}
+
+func (p *Program) fault(kind FaultKind, i, instrCode, mode, address int) *Fault {
+	return &Fault{
+		Kind:        kind,
+		IP:          p.instrPtr,
+		Instruction: instrCode,
+		Opcode:      instrCode % 100,
+		Param:       i + 1,
+		Mode:        mode,
+		Address:     address,
 	}
-	return dest
 }
@@ -0,0 +1,84 @@
+package intcode
+
+import (
+	"os"
+	"testing"
+)
+
+// loopSource counts down from its input, using relative and extra memory
+const loopSource = `
+        ARB #5000
+        IN -> [rb+0]
+loop:   ADD [rb+0], #-1 -> [rb+0]
+        MUL [rb+0], #2 -> [rb+1]
+        LT [rb+1], [n] -> [rb+2]
+        JT [rb+0], #loop
+        OUT [rb+1]
+        HLT
+n:      .data 10
+`
+
+func benchmarkProgram(b *testing.B, program []int, inputs ...int) {
+	b.Helper()
+	create := ProgramCreator(program)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := create()
+		p.Feed(inputs...)
+		if err := p.RunIO(nil, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBoost(b *testing.B) {
+	if _, err := os.Stat("../day09/input.txt"); err != nil {
+		b.Skip("no day09 input")
+	}
+	program, err := ReadProgram("../day09/input.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("test", func(b *testing.B) { benchmarkProgram(b, program, 1) })
+	b.Run("sensor", func(b *testing.B) { benchmarkProgram(b, program, 2) })
+}
+
+func BenchmarkQuine(b *testing.B) {
+	program := []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}
+	benchmarkProgram(b, program)
+}
+
+func BenchmarkLoop(b *testing.B) {
+	program, err := AssembleString(loopSource)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, n := range []struct {
+		name  string
+		count int
+	}{{"1k", 1000}, {"100k", 100000}} {
+		b.Run(n.name, func(b *testing.B) { benchmarkProgram(b, program, n.count) })
+	}
+}
+
+// BenchmarkInstances measures creating and running many short programs
+func BenchmarkInstances(b *testing.B) {
+	program, err := AssembleString(loopSource)
+	if err != nil {
+		b.Fatal(err)
+	}
+	create := ProgramCreator(program)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := create()
+		p.Feed(10)
+		for {
+			status := p.Resume()
+			if status.Kind != HasOutput {
+				break
+			}
+		}
+	}
+}
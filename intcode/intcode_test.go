@@ -0,0 +1,59 @@
+package intcode
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStart(t *testing.T) {
+	// reads a value and writes its double
+	p := ProgramCreator([]int{3, 9, 1002, 9, 2, 9, 4, 9, 99, 0})()
+
+	in := make(chan int, 1)
+	out := make(chan int)
+	done := p.Start(context.Background(), in, out)
+	in <- 21
+
+	var values []int
+	for v := range out {
+		values = append(values, v)
+	}
+	if len(values) != 1 || values[0] != 42 {
+		t.Errorf("got %v, want [42]", values)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if _, ok := <-done; ok {
+		t.Error("done is not closed")
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []int
+	}{
+		{"waiting for input", []int{3, 0, 99}},
+		{"waiting for output", []int{104, 1, 99}},
+		{"infinite loop", []int{1105, 1, 0}},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan int)
+		done := ProgramCreator(test.program)().Start(ctx, make(chan int), out)
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != context.Canceled {
+				t.Errorf("%v: got %v, want %v", test.name, err, context.Canceled)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v: the program is still running after its cancellation", test.name)
+		}
+		if _, ok := <-out; ok {
+			t.Errorf("%v: out is not closed", test.name)
+		}
+	}
+}
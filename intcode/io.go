@@ -0,0 +1,202 @@
+package intcode
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Input provides the values read by a program
+type Input interface {
+	// Read returns the next value
+	// with ErrNoInput, the input instruction is not executed and can be retried
+	Read() (int, error)
+}
+
+// Output receives the values written by a program
+type Output interface {
+	Write(v int) error
+}
+
+// ErrNoInput is returned when no input value is available yet
+var ErrNoInput = errors.New("no input available")
+
+// ErrInputClosed is returned when the program reads from a closed input channel
+var ErrInputClosed = errors.New("input channel closed")
+
+// InputFunc allows to use a function as an Input
+type InputFunc func() (int, error)
+
+// Read calls f
+func (f InputFunc) Read() (int, error) {
+	return f()
+}
+
+// OutputFunc allows to use a function as an Output
+type OutputFunc func(int) error
+
+// Write calls f
+func (f OutputFunc) Write(v int) error {
+	return f(v)
+}
+
+type chanInput struct {
+	ch  <-chan int
+	ctx context.Context
+}
+
+// ChanInput reads values from a channel
+func ChanInput(ch <-chan int) Input {
+	return &chanInput{ch: ch}
+}
+
+func (c *chanInput) Read() (int, error) {
+	var done <-chan struct{}
+	if c.ctx != nil {
+		done = c.ctx.Done()
+	}
+	select {
+	case v, ok := <-c.ch:
+		if !ok {
+			return 0, ErrInputClosed
+		}
+		return v, nil
+	case <-done:
+		return 0, c.ctx.Err()
+	}
+}
+
+type chanOutput struct {
+	ch  chan<- int
+	ctx context.Context
+}
+
+// ChanOutput sends values to a channel
+func ChanOutput(ch chan<- int) Output {
+	return &chanOutput{ch: ch}
+}
+
+func (c *chanOutput) Write(v int) error {
+	var done <-chan struct{}
+	if c.ctx != nil {
+		done = c.ctx.Done()
+	}
+	select {
+	case c.ch <- v:
+		return nil
+	case <-done:
+		return c.ctx.Err()
+	}
+}
+
+// inputWithContext returns in interrupted by ctx while it waits, if it can be
+func inputWithContext(ctx context.Context, in Input) Input {
+	if c, ok := in.(*chanInput); ok {
+		return &chanInput{ch: c.ch, ctx: ctx}
+	}
+	return in
+}
+
+// outputWithContext returns out interrupted by ctx while it waits, if it can be
+func outputWithContext(ctx context.Context, out Output) Output {
+	if c, ok := out.(*chanOutput); ok {
+		return &chanOutput{ch: c.ch, ctx: ctx}
+	}
+	return out
+}
+
+// SliceInput reads values from a fixed slice
+// it returns ErrNoInput once every value is read
+func SliceInput(values ...int) Input {
+	q := &Queue{}
+	q.Push(values...)
+	return q
+}
+
+// SliceOutput collects the values written
+type SliceOutput struct {
+	Values []int
+}
+
+// Write appends v to the collected values
+func (s *SliceOutput) Write(v int) error {
+	s.Values = append(s.Values, v)
+	return nil
+}
+
+// Queue is a FIFO usable both as Input and Output
+// reading an empty queue returns ErrNoInput
+type Queue struct {
+	values []int
+}
+
+// Push adds values at the end of the queue
+func (q *Queue) Push(values ...int) {
+	q.values = append(q.values, values...)
+}
+
+// Len is the number of values in the queue
+func (q *Queue) Len() int {
+	return len(q.values)
+}
+
+// Values returns a copy of the queued values
+func (q *Queue) Values() []int {
+	return append([]int(nil), q.values...)
+}
+
+// Read pops the first value
+func (q *Queue) Read() (int, error) {
+	if len(q.values) == 0 {
+		return 0, ErrNoInput
+	}
+	v := q.values[0]
+	q.values = q.values[1:]
+	return v, nil
+}
+
+// Write pushes v at the end of the queue
+func (q *Queue) Write(v int) error {
+	q.Push(v)
+	return nil
+}
+
+type asciiInput struct {
+	r *bufio.Reader
+}
+
+// ASCIIInput reads the bytes of r as input values
+// the end of r is reported as io.EOF
+func ASCIIInput(r io.Reader) Input {
+	return &asciiInput{r: bufio.NewReader(r)}
+}
+
+func (a *asciiInput) Read() (int, error) {
+	b, err := a.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return int(b), nil
+}
+
+type asciiOutput struct {
+	w io.Writer
+}
+
+// ASCIIOutput writes values as bytes to w
+// values outside of a byte are written as numbers on their own line
+func ASCIIOutput(w io.Writer) Output {
+	return &asciiOutput{w: w}
+}
+
+func (a *asciiOutput) Write(v int) error {
+	var err error
+	if v >= 0 && v <= 0xff {
+		_, err = a.w.Write([]byte{byte(v)})
+	} else {
+		_, err = fmt.Fprintf(a.w, "%d\n", v)
+	}
+	return err
+}
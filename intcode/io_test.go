@@ -0,0 +1,97 @@
+package intcode
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// echo writes every value it reads until it reads 0
+var echo = []int{3, 11, 1006, 11, 10, 4, 11, 1105, 1, 0, 99, 0}
+
+func TestSliceInputRetry(t *testing.T) {
+	p := ProgramCreator(echo)()
+	out := &SliceOutput{}
+	if err := p.RunIO(nil, SliceInput(1, 2), out); err != ErrNoInput {
+		t.Fatalf("got %v, want %v", err, ErrNoInput)
+	}
+	// the input instruction is executed again with the next input
+	if err := p.RunIO(nil, SliceInput(3, 0), out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Values; len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("got %v, want [1 2 3]", got)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	// the outputs of the first program are the inputs of the second one
+	q := &Queue{}
+	if err := ProgramCreator(echo)().RunIO(nil, SliceInput(4, 5, 0), q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("got %v values, want 2", q.Len())
+	}
+	q.Push(0)
+	out := &SliceOutput{}
+	if err := ProgramCreator(echo)().RunIO(nil, q, out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Values; len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("got %v, want [4 5]", got)
+	}
+	if q.Len() != 0 {
+		t.Errorf("got %v left in the queue, want none", q.Values())
+	}
+}
+
+func TestChanInputClosed(t *testing.T) {
+	in := make(chan int, 1)
+	in <- 6
+	close(in)
+	out := &SliceOutput{}
+	if err := ProgramCreator(echo)().RunIO(nil, ChanInput(in), out); err != ErrInputClosed {
+		t.Errorf("got %v, want %v", err, ErrInputClosed)
+	}
+	if len(out.Values) != 1 || out.Values[0] != 6 {
+		t.Errorf("got %v, want [6]", out.Values)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	n := 3
+	in := InputFunc(func() (int, error) {
+		n--
+		return n, nil
+	})
+	sum := 0
+	out := OutputFunc(func(v int) error {
+		sum += v
+		return nil
+	})
+	if err := ProgramCreator(echo)().RunIO(nil, in, out); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 3 {
+		t.Errorf("got %v, want 3", sum)
+	}
+}
+
+func TestASCII(t *testing.T) {
+	var b bytes.Buffer
+	p := ProgramCreator(echo)()
+	// the end of the reader is the end of the input
+	if err := p.RunIO(nil, ASCIIInput(strings.NewReader("hi\n")), ASCIIOutput(&b)); err != io.EOF {
+		t.Fatalf("got %v, want %v", err, io.EOF)
+	}
+	// values outside of a byte are written as numbers
+	p = ProgramCreator([]int{104, 1000, 99})()
+	if err := p.RunIO(nil, nil, ASCIIOutput(&b)); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "hi\n1000\n" {
+		t.Errorf("got %q, want %q", b.String(), "hi\n1000\n")
+	}
+}
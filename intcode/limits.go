@@ -0,0 +1,130 @@
+package intcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errors returned when a limit set by an Option is exceeded
+var (
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+	ErrMemoryLimit      = errors.New("memory limit exceeded")
+	ErrOutputLimit      = errors.New("output limit exceeded")
+	ErrTimeLimit        = errors.New("time limit exceeded")
+)
+
+// Option configures the programs created by ProgramCreator
+type Option func(*Program)
+
+// limits bounds the execution of a program, a zero value means no limit
+type limits struct {
+	maxInstructions int
+	maxMemory       int
+	maxOutputs      int
+	timeout         time.Duration
+
+	steps    int
+	outputs  int
+	deadline time.Time
+}
+
+func (p *Program) limits() *limits {
+	if p.limit == nil {
+		p.limit = &limits{}
+	}
+	return p.limit
+}
+
+// WithMaxInstructions stops the program with ErrInstructionLimit after n instructions
+func WithMaxInstructions(n int) Option {
+	return func(p *Program) {
+		p.limits().maxInstructions = n
+	}
+}
+
+// WithMaxMemory stops the program with ErrMemoryLimit when it accesses
+// an address greater or equal to n
+func WithMaxMemory(n int) Option {
+	return func(p *Program) {
+		p.limits().maxMemory = n
+	}
+}
+
+// WithMaxOutputs stops the program with ErrOutputLimit when it tries
+// to write more than n values
+func WithMaxOutputs(n int) Option {
+	return func(p *Program) {
+		p.limits().maxOutputs = n
+	}
+}
+
+// WithTimeout stops the program with ErrTimeLimit when it runs for more than d
+// the time is counted from its first instruction, waiting for IO included
+// a program waiting on the channels given to Run, RunContext or Start is
+// interrupted at the deadline, other IO is only checked once it returns
+func WithTimeout(d time.Duration) Option {
+	return func(p *Program) {
+		p.limits().timeout = d
+	}
+}
+
+// checkStep is called before executing an instruction, steps are counted once executed
+func (l *limits) checkStep(ip int) error {
+	if l.maxInstructions > 0 && l.steps >= l.maxInstructions {
+		return fmt.Errorf("%w: %v instructions executed, at ip %v", ErrInstructionLimit, l.steps, ip)
+	}
+	if l.maxMemory > 0 && ip >= l.maxMemory {
+		return fmt.Errorf("%w: ip %v", ErrMemoryLimit, ip)
+	}
+	if l.timeout > 0 {
+		if l.deadline.IsZero() {
+			l.deadline = time.Now().Add(l.timeout)
+		} else if l.steps%1024 == 0 && time.Now().After(l.deadline) {
+			return l.timeLimit(ip)
+		}
+	}
+	return nil
+}
+
+func (l *limits) timeLimit(ip int) error {
+	return fmt.Errorf("%w: ran for more than %v, at ip %v", ErrTimeLimit, l.timeout, ip)
+}
+
+// withDeadline derives from ctx, which may be nil, a context done once the
+// time limit is exceeded, the time starts now if the program didn't run yet
+func (l *limits) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.deadline.IsZero() {
+		l.deadline = time.Now().Add(l.timeout)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithDeadline(ctx, l.deadline)
+}
+
+// checkDeadline turns err into a time limit error if it comes from the
+// context of withDeadline and not from its parent
+func (l *limits) checkDeadline(parent context.Context, err error, ip int) error {
+	if !errors.Is(err, context.DeadlineExceeded) || (parent != nil && parent.Err() != nil) {
+		return err
+	}
+	return l.timeLimit(ip)
+}
+
+// checkAddress is called before accessing memory at address
+func (l *limits) checkAddress(ip, address int) error {
+	if l.maxMemory > 0 && address >= l.maxMemory {
+		return fmt.Errorf("%w: address %v at ip %v", ErrMemoryLimit, address, ip)
+	}
+	return nil
+}
+
+// checkOutput is called before writing an output, outputs are counted once written
+func (l *limits) checkOutput(ip int) error {
+	if l.maxOutputs > 0 && l.outputs >= l.maxOutputs {
+		return fmt.Errorf("%w: %v values written, at ip %v", ErrOutputLimit, l.outputs, ip)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package intcode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeoutWhileWaiting(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []int
+	}{
+		{"input", []int{3, 0, 99}},
+		{"output", []int{104, 1, 104, 2, 99}},
+	} {
+		p := ProgramCreator(test.program, WithTimeout(20*time.Millisecond))()
+		// nothing is sent nor received, the program waits until its deadline
+		done := p.Start(context.Background(), make(chan int), make(chan int))
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrTimeLimit) {
+				t.Errorf("%v: got %v, want %v", test.name, err, ErrTimeLimit)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v: the program is still waiting after its deadline", test.name)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package intcode
+
+const (
+	pageBits = 10
+	pageSize = 1 << pageBits
+	pageMask = pageSize - 1
+	// pages beyond this limit are stored in a map to avoid huge page tables
+	maxDensePages = 1 << 16
+)
+
+// memory is the address space of a program, split in pages of pageSize cells
+// pages are allocated on first write, reading an unallocated cell gives 0
+// pages are shared with clones until one of them writes it, copy on write
+type memory struct {
+	pages [][]int
+	// owned tells which pages can be written in place, it has the length of pages
+	owned []bool
+	// far holds pages of very high addresses, they are never shared
+	far map[int][]int
+}
+
+func newMemory(program []int) memory {
+	var m memory
+	m.pages = make([][]int, (len(program)+pageMask)>>pageBits)
+	m.owned = make([]bool, len(m.pages))
+	for i := range m.pages {
+		page := make([]int, pageSize)
+		copy(page, program[i<<pageBits:])
+		m.pages[i] = page
+		m.owned[i] = true
+	}
+	return m
+}
+
+// clone returns a memory sharing the pages of m
+// from now on, both copy a page before writing it
+func (m *memory) clone() memory {
+	c := memory{
+		pages: append([][]int(nil), m.pages...),
+		owned: make([]bool, len(m.pages)),
+	}
+	for i := range m.owned {
+		m.owned[i] = false
+	}
+	if m.far != nil {
+		c.far = make(map[int][]int, len(m.far))
+		for idx, page := range m.far {
+			c.far[idx] = append([]int(nil), page...)
+		}
+	}
+	return c
+}
+
+// at returns the value at address, 0 for a negative address
+func (m *memory) at(address int) int {
+	if address < 0 {
+		return 0
+	}
+	idx := address >> pageBits
+	if idx < len(m.pages) {
+		if page := m.pages[idx]; page != nil {
+			return page[address&pageMask]
+		}
+		return 0
+	}
+	if page, found := m.far[idx]; found {
+		return page[address&pageMask]
+	}
+	return 0
+}
+
+// set writes v at address, address must not be negative
+func (m *memory) set(address, v int) {
+	idx := address >> pageBits
+	if idx < len(m.pages) {
+		page := m.pages[idx]
+		if !m.owned[idx] {
+			page = m.own(idx)
+		}
+		page[address&pageMask] = v
+		return
+	}
+	m.page(idx)[address&pageMask] = v
+}
+
+// own gives m its own copy of page idx, allocating it if needed
+func (m *memory) own(idx int) []int {
+	page := make([]int, pageSize)
+	copy(page, m.pages[idx])
+	m.pages[idx] = page
+	m.owned[idx] = true
+	return page
+}
+
+// page returns the page idx out of the page table, allocating it if needed
+func (m *memory) page(idx int) []int {
+	if idx < maxDensePages {
+		if idx >= cap(m.pages) {
+			pages := make([][]int, len(m.pages), 2*(idx+1))
+			copy(pages, m.pages)
+			m.pages = pages
+		}
+		m.pages = m.pages[:idx+1]
+		for len(m.owned) < len(m.pages) {
+			m.owned = append(m.owned, false)
+		}
+		return m.own(idx)
+	}
+	if m.far == nil {
+		m.far = make(map[int][]int)
+	}
+	page, found := m.far[idx]
+	if !found {
+		page = make([]int, pageSize)
+		m.far[idx] = page
+	}
+	return page
+}
+
+// cells calls f for every non zero cell at or after start
+func (m *memory) cells(start int, f func(address, v int)) {
+	visit := func(idx int, page []int) {
+		for i, v := range page {
+			if address := idx<<pageBits + i; v != 0 && address >= start {
+				f(address, v)
+			}
+		}
+	}
+	for idx, page := range m.pages {
+		visit(idx, page)
+	}
+	for idx, page := range m.far {
+		visit(idx, page)
+	}
+}
@@ -0,0 +1,34 @@
+package intcode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryAt(t *testing.T) {
+	p := ProgramCreator([]int{1, 2, 3})()
+	p.SetMemory(1<<20, 4)
+
+	for _, test := range []struct {
+		address int
+		want    int
+	}{
+		{0, 1},
+		{2, 3},
+		{3, 0},
+		{1 << 20, 4},
+		{-1, 0},
+		{-1 << 20, 0},
+	} {
+		if got := p.MemoryAt(test.address); got != test.want {
+			t.Errorf("address %v: got %v, want %v", test.address, got, test.want)
+		}
+	}
+
+	if got := p.MemorySlice(-2, 2); !reflect.DeepEqual(got, []int{0, 0, 1, 2}) {
+		t.Errorf("got %v, want [0 0 1 2]", got)
+	}
+	if got := p.MemorySlice(2, 1); len(got) != 0 {
+		t.Errorf("got %v, want an empty slice", got)
+	}
+}
@@ -0,0 +1,31 @@
+package intcode
+
+// EventKind tells what a program exchanged with its driver
+type EventKind string
+
+// kinds of exchanges
+const (
+	InputEvent  EventKind = "input"
+	OutputEvent EventKind = "output"
+	HaltEvent   EventKind = "halt"
+)
+
+// Monitor follows the execution of a Program, like a debugger
+type Monitor interface {
+	// Before is called before the instruction at the instruction pointer is executed
+	// it may block to pause the program, an error stops it without executing the instruction
+	Before(p *Program) error
+	// Exchanged is called once the program read or wrote v, or halted
+	Exchanged(p *Program, kind EventKind, v int)
+}
+
+// SetMonitor attaches a monitor to the program, nil detaches it
+// unlike the other tools, the monitor is kept by clones
+func (p *Program) SetMonitor(m Monitor) {
+	p.monitor = m
+}
+
+// InstructionPointer returns the address of the next instruction
+func (p *Program) InstructionPointer() int {
+	return p.instrPtr
+}
@@ -0,0 +1,351 @@
+// Package network runs intcode programs exchanging packets on a shared bus
+//
+// Every program receives its address as first input. It sends a packet by
+// writing three values: the destination address, x and y. It reads -1 when
+// no packet is waiting for it, or the x and y of the next packet.
+package network
+
+import (
+	"adventofcode2019/intcode"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrStop can be returned by a hook to end the run without error
+var ErrStop = errors.New("network stopped")
+
+// ErrIdle is returned when every program waits for a packet and no NAT can wake them up
+var ErrIdle = errors.New("network is idle")
+
+// idleReads is the number of empty reads since the last activity on the bus
+// making a program idle
+const idleReads = 2
+
+// Packet is a message sent on the bus
+type Packet struct {
+	From, Dest int
+	X, Y       int
+}
+
+// NAT receives the packets sent to its address and wakes up an idle network
+type NAT interface {
+	// Receive is called for every packet sent to the NAT
+	Receive(p Packet) error
+	// Idle is called when every program waits for a packet
+	// it returns the packets to deliver, ErrStop ends the run
+	Idle() ([]Packet, error)
+}
+
+// Network is a set of programs sharing a bus
+type Network struct {
+	// Monitor, if set, is called for every packet sent, ErrStop ends the run
+	Monitor func(p Packet) error
+	// NAT, if set, receives packets sent to NATAddress
+	NAT        NAT
+	NATAddress int
+
+	machines []*machine
+	mu       sync.Mutex
+	err      error
+	cancel   context.CancelFunc
+	// pending counts the packets being written or waiting in a queue
+	pending int
+	// activity counts the values written and the packets delivered or read,
+	// so idleness is only decided on reads made after the last one
+	activity int
+}
+
+// machine is a program and its state on the bus
+type machine struct {
+	program *intcode.Program
+	address int
+	queue   []int
+	// partial holds the values of a packet being written
+	partial []int
+	// empty counts the reads with no packet made since activity was seen
+	empty    int
+	activity int
+	halted   bool
+}
+
+// New creates a network where programs[i] has address i
+func New(programs ...*intcode.Program) *Network {
+	n := &Network{NATAddress: 255}
+	for address, p := range programs {
+		p.Feed(address)
+		n.machines = append(n.machines, &machine{program: p, address: address})
+	}
+	return n
+}
+
+// Send puts a packet on the bus, as if it was written by a program
+func (n *Network) Send(p Packet) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.route(p)
+}
+
+// route delivers a packet, n.mu must be held
+func (n *Network) route(p Packet) error {
+	if n.Monitor != nil {
+		if err := n.Monitor(p); err != nil {
+			return err
+		}
+	}
+	if n.NAT != nil && p.Dest == n.NATAddress {
+		return n.NAT.Receive(p)
+	}
+	if p.Dest < 0 || p.Dest >= len(n.machines) {
+		return fmt.Errorf("packet from %v to unknown address %v", p.From, p.Dest)
+	}
+	n.deliver(p)
+	return nil
+}
+
+// deliver queues a packet for a program, n.mu must be held
+func (n *Network) deliver(p Packet) {
+	m := n.machines[p.Dest]
+	if m.halted {
+		// nobody will read it
+		return
+	}
+	m.queue = append(m.queue, p.X, p.Y)
+	n.pending++
+	n.activity++
+}
+
+// halt takes m off the bus with the packets it will never read or finish, n.mu must be held
+func (n *Network) halt(m *machine) {
+	m.halted = true
+	n.pending -= len(m.queue) / 2
+	if len(m.partial) > 0 {
+		n.pending--
+	}
+	m.queue, m.partial = nil, nil
+}
+
+// write collects the values written by m, n.mu must be held
+func (n *Network) write(m *machine, v int) error {
+	n.activity++
+	if len(m.partial) == 0 {
+		n.pending++
+	}
+	m.partial = append(m.partial, v)
+	if len(m.partial) < 3 {
+		return nil
+	}
+	p := Packet{From: m.address, Dest: m.partial[0], X: m.partial[1], Y: m.partial[2]}
+	m.partial = m.partial[:0]
+	n.pending--
+	return n.route(p)
+}
+
+// read gives the next value for m, -1 if its queue is empty, n.mu must be held
+func (n *Network) read(m *machine) (int, error) {
+	if len(m.queue) > 0 {
+		v := m.queue[0]
+		m.queue = m.queue[1:]
+		if len(m.queue)%2 == 0 {
+			// y is read, the packet is received
+			n.pending--
+		}
+		n.activity++
+		return v, nil
+	}
+	if m.activity != n.activity {
+		m.activity, m.empty = n.activity, 0
+	}
+	m.empty++
+	if n.idle() {
+		if err := n.wakeUp(); err != nil {
+			return 0, err
+		}
+	}
+	return -1, nil
+}
+
+// idle informs if every running program waits for a packet, n.mu must be held
+// no packet must be on its way and every program must have read nothing
+// idleReads times since the last activity, reads being made with n.mu held
+// even in concurrent runs
+func (n *Network) idle() bool {
+	if n.pending > 0 {
+		return false
+	}
+	running := 0
+	for _, m := range n.machines {
+		if m.halted {
+			continue
+		}
+		running++
+		if m.activity != n.activity || m.empty < idleReads {
+			return false
+		}
+	}
+	return running > 0
+}
+
+// wakeUp asks the NAT for packets, n.mu must be held
+func (n *Network) wakeUp() error {
+	if n.NAT == nil {
+		return ErrIdle
+	}
+	packets, err := n.NAT.Idle()
+	if err != nil {
+		return err
+	}
+	for _, p := range packets {
+		if p.Dest < 0 || p.Dest >= len(n.machines) {
+			return fmt.Errorf("NAT packet to unknown address %v", p.Dest)
+		}
+		n.deliver(p)
+	}
+	return nil
+}
+
+// Run executes the programs in the calling goroutine until they all halt,
+// a hook stops the network or ctx is done
+// programs are resumed in turn, in address order, so runs are deterministic
+func (n *Network) Run(ctx context.Context) error {
+	for {
+		if ctx != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		running := 0
+		for _, m := range n.machines {
+			if m.halted {
+				continue
+			}
+			running++
+			if err := n.resume(m); err != nil {
+				if errors.Is(err, ErrStop) {
+					return nil
+				}
+				return err
+			}
+		}
+		if running == 0 {
+			return nil
+		}
+	}
+}
+
+// resume executes m until it needs an input
+func (n *Network) resume(m *machine) error {
+	for {
+		status := m.program.Resume()
+		switch status.Kind {
+		case intcode.HasOutput:
+			if err := n.write(m, status.Value); err != nil {
+				return err
+			}
+		case intcode.NeedInput:
+			// x and y of a packet are read in a row
+			v, err := n.read(m)
+			if err != nil {
+				return err
+			}
+			m.program.Feed(v)
+			if v == -1 || len(m.queue)%2 == 0 {
+				return nil
+			}
+		case intcode.Halted:
+			n.halt(m)
+			return nil
+		default:
+			return fmt.Errorf("program %v: %v", m.address, status.Err)
+		}
+	}
+}
+
+// RunConcurrent executes every program in its own goroutine until they all halt,
+// a hook stops the network or ctx is done
+// hooks are called with the bus locked, one at a time
+func (n *Network) RunConcurrent(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, n.cancel = context.WithCancel(ctx)
+	defer n.cancel()
+
+	var wg sync.WaitGroup
+	for _, m := range n.machines {
+		wg.Add(1)
+		go func(m *machine) {
+			defer wg.Done()
+			err := m.program.RunIO(ctx, &port{n, m}, &port{n, m})
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if err == nil {
+				n.halt(m)
+			}
+			if err != nil && n.err == nil && ctx.Err() == nil {
+				n.err = fmt.Errorf("program %v: %w", m.address, err)
+				n.cancel()
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	if errors.Is(n.err, ErrStop) {
+		return nil
+	}
+	if n.err != nil {
+		return n.err
+	}
+	return ctx.Err()
+}
+
+// port is the input and output of a program run by RunConcurrent
+type port struct {
+	n *Network
+	m *machine
+}
+
+func (p *port) Read() (int, error) {
+	p.n.mu.Lock()
+	if p.n.err != nil {
+		// the network is stopping, hooks must not be called anymore
+		p.n.mu.Unlock()
+		return 0, p.n.err
+	}
+	v, err := p.n.read(p.m)
+	p.n.mu.Unlock()
+	if v == -1 {
+		// let the others work instead of polling
+		runtime.Gosched()
+	}
+	return v, p.n.stop(err)
+}
+
+func (p *port) Write(v int) error {
+	p.n.mu.Lock()
+	if p.n.err != nil {
+		p.n.mu.Unlock()
+		return p.n.err
+	}
+	err := p.n.write(p.m, v)
+	p.n.mu.Unlock()
+	return p.n.stop(err)
+}
+
+// stop ends a concurrent run on the first hook error
+func (n *Network) stop(err error) error {
+	if err == nil {
+		return nil
+	}
+	n.mu.Lock()
+	if n.err == nil {
+		n.err = err
+	}
+	n.mu.Unlock()
+	n.cancel()
+	return err
+}
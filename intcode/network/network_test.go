@@ -0,0 +1,53 @@
+package network
+
+import (
+	"adventofcode2019/intcode"
+	"context"
+	"reflect"
+	"testing"
+)
+
+// echo sends every packet it receives to the NAT, at address 255
+var echo = []int{
+	3, 100, // IN -> [100], the address
+	3, 101, // IN -> [101], x or -1
+	1008, 101, -1, 102, // EQ [101], #-1 -> [102]
+	1005, 102, 2, // JT [102], #2
+	3, 103, // IN -> [103], y
+	104, 255, // OUT #255
+	4, 101, // OUT [101]
+	4, 103, // OUT [103]
+	1105, 1, 2, // JT #1, #2
+}
+
+func TestRelayNAT(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		run  func(n *Network) error
+	}{
+		{"run", func(n *Network) error { return n.Run(nil) }},
+		{"concurrent", func(n *Network) error { return n.RunConcurrent(context.Background()) }},
+	} {
+		create := intcode.ProgramCreator(echo)
+		var programs []*intcode.Program
+		for i := 0; i < 10; i++ {
+			programs = append(programs, create())
+		}
+		n := New(programs...)
+		nat := &RelayNAT{}
+		n.NAT = nat
+		if err := n.Send(Packet{From: -1, Dest: 3, X: 7, Y: 9}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := test.run(n); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		// machine 3 echoes the first packet, the NAT relays it to machine 0
+		// which echoes it again, then the NAT would send the same y twice
+		want := []Packet{{From: -1, Dest: 0, X: 7, Y: 9}, {From: -1, Dest: 0, X: 7, Y: 9}}
+		if !reflect.DeepEqual(nat.Sent, want) {
+			t.Errorf("%v: got %v, want %v", test.name, nat.Sent, want)
+		}
+	}
+}
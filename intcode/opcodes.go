@@ -0,0 +1,249 @@
+package intcode
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// ParamRole tells how an instruction uses a parameter
+type ParamRole int
+
+const (
+	// Read parameters are resolved to a value according to their mode
+	Read ParamRole = iota
+	// Write parameters are resolved to an address, they can't be immediate
+	Write
+)
+
+// maxParams is the number of parameter modes an instruction code can hold
+const maxParams = 3
+
+// JumpCondition tells when a jump is taken, according to its first parameter
+type JumpCondition int
+
+const (
+	// JumpMaybe is a jump which may be taken or not whatever its first parameter
+	JumpMaybe JumpCondition = iota
+	// JumpIfTrue is taken when the first parameter is not zero
+	JumpIfTrue
+	// JumpIfFalse is taken when the first parameter is zero
+	JumpIfFalse
+)
+
+// Handler executes an instruction, args are its resolved parameters:
+// a value for each Read parameter and an address for each Write parameter
+// the instruction pointer moves to the next instruction unless the handler
+// calls Jump or Halt, and nothing must be changed if an error is returned
+type Handler func(p *Program, args []int) error
+
+// Opcode declares an instruction
+type Opcode struct {
+	Code     int
+	Mnemonic string
+	Params   []ParamRole
+	// Jump is set for conditional jumps whose second parameter is the target,
+	// the analysis tools follow them
+	Jump bool
+	// When tells the analysis tools if the jump is taken, from an immediate condition
+	When JumpCondition
+	// Stop is set when the next instruction is never executed, like for a halt
+	Stop    bool
+	Handler Handler
+
+	// write is the index of the first Write parameter, -1 if none
+	write int
+	// big is set when the handler supports values which don't fit in an int
+	big bool
+}
+
+// InstructionSet holds the opcodes a program can execute
+type InstructionSet struct {
+	opcodes [100]*Opcode
+}
+
+// builtins is the instruction set of the intcode computer
+var builtins = newBuiltins()
+
+func newBuiltins() *InstructionSet {
+	s := &InstructionSet{}
+	for _, op := range []Opcode{
+		{Code: 1, Mnemonic: "ADD", Params: []ParamRole{Read, Read, Write}, Handler: executeAdd, big: true},
+		{Code: 2, Mnemonic: "MUL", Params: []ParamRole{Read, Read, Write}, Handler: executeMultiply, big: true},
+		{Code: 3, Mnemonic: "IN", Params: []ParamRole{Write}, Handler: executeInput, big: true},
+		{Code: 4, Mnemonic: "OUT", Params: []ParamRole{Read}, Handler: executeOutput, big: true},
+		{Code: 5, Mnemonic: "JT", Params: []ParamRole{Read, Read}, Jump: true, When: JumpIfTrue, Handler: executeJumpIfTrue, big: true},
+		{Code: 6, Mnemonic: "JF", Params: []ParamRole{Read, Read}, Jump: true, When: JumpIfFalse, Handler: executeJumpIfFalse, big: true},
+		{Code: 7, Mnemonic: "LT", Params: []ParamRole{Read, Read, Write}, Handler: executeLessThan, big: true},
+		{Code: 8, Mnemonic: "EQ", Params: []ParamRole{Read, Read, Write}, Handler: executeEquals, big: true},
+		{Code: 9, Mnemonic: "ARB", Params: []ParamRole{Read}, Handler: executeRelativeBaseOffset, big: true},
+		{Code: 99, Mnemonic: "HLT", Stop: true, Handler: executeHalt, big: true},
+	} {
+		if err := s.Register(op); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// NewInstructionSet creates an instruction set with the built-in opcodes
+// it is given to programs with the WithInstructionSet option
+func NewInstructionSet() *InstructionSet {
+	s := *builtins
+	return &s
+}
+
+// Register adds an opcode to the set, replacing the one with the same code
+func (s *InstructionSet) Register(op Opcode) error {
+	if op.Code <= 0 || op.Code >= len(s.opcodes) {
+		return fmt.Errorf("opcode %v out of range 1-99", op.Code)
+	}
+	if len(op.Params) > maxParams {
+		return fmt.Errorf("opcode %v has %v parameters, %v at most", op.Code, len(op.Params), maxParams)
+	}
+	if op.Jump && len(op.Params) < 2 {
+		return fmt.Errorf("jump opcode %v has no target parameter", op.Code)
+	}
+	if op.Handler == nil {
+		return fmt.Errorf("opcode %v has no handler", op.Code)
+	}
+
+	op.Params = append([]ParamRole(nil), op.Params...)
+	op.write = -1
+	for i, role := range op.Params {
+		if role == Write && op.write < 0 {
+			op.write = i
+		}
+	}
+	s.opcodes[op.Code] = &op
+	return nil
+}
+
+// Lookup returns the opcode registered for code
+func (s *InstructionSet) Lookup(code int) (Opcode, bool) {
+	if op := s.lookup(code); op != nil {
+		return *op, true
+	}
+	return Opcode{}, false
+}
+
+// lookup returns the opcode registered for code, nil if none
+// a nil set is the built-in one
+func (s *InstructionSet) lookup(code int) *Opcode {
+	if s == nil {
+		s = builtins
+	}
+	if code < 0 || code >= len(s.opcodes) {
+		return nil
+	}
+	return s.opcodes[code]
+}
+
+// WithInstructionSet makes programs execute the opcodes of s
+// s must not be changed while programs use it
+func WithInstructionSet(s *InstructionSet) Option {
+	return func(p *Program) {
+		p.instructions = s
+	}
+}
+
+func executeAdd(p *Program, args []int) error {
+	if p.arithmetic != WrappingArithmetic {
+		return p.computeChecked(args, addInts, (*big.Int).Add)
+	}
+	p.Store(args[2], args[0]+args[1])
+	return nil
+}
+
+func executeMultiply(p *Program, args []int) error {
+	if p.arithmetic != WrappingArithmetic {
+		return p.computeChecked(args, mulInts, (*big.Int).Mul)
+	}
+	p.Store(args[2], args[0]*args[1])
+	return nil
+}
+
+func executeInput(p *Program, args []int) error {
+	v, err := p.ReadInput()
+	if err != nil {
+		return err
+	}
+	p.Store(args[0], v)
+	return nil
+}
+
+func executeOutput(p *Program, args []int) error {
+	if p.isBig(0) {
+		return p.writeBigOutput(p.bigArgs[0])
+	}
+	return p.WriteOutput(args[0])
+}
+
+// a value which doesn't fit in an int is never 0
+func executeJumpIfTrue(p *Program, args []int) error {
+	if args[0] != 0 || p.isBig(0) {
+		return p.jumpTo(args)
+	}
+	return nil
+}
+
+func executeJumpIfFalse(p *Program, args []int) error {
+	if args[0] == 0 && !p.isBig(0) {
+		return p.jumpTo(args)
+	}
+	return nil
+}
+
+// jumpTo jumps to the target of a conditional jump
+func (p *Program) jumpTo(args []int) error {
+	if p.isBig(1) {
+		return p.overflow(1)
+	}
+	p.Jump(args[1])
+	return nil
+}
+
+func executeLessThan(p *Program, args []int) error {
+	less := args[0] < args[1]
+	if p.isBig(0) || p.isBig(1) {
+		less = p.compareBig(args) < 0
+	}
+	if less {
+		p.Store(args[2], 1)
+	} else {
+		p.Store(args[2], 0)
+	}
+	return nil
+}
+
+func executeEquals(p *Program, args []int) error {
+	equal := args[0] == args[1]
+	if p.isBig(0) || p.isBig(1) {
+		equal = p.compareBig(args) == 0
+	}
+	if equal {
+		p.Store(args[2], 1)
+	} else {
+		p.Store(args[2], 0)
+	}
+	return nil
+}
+
+func executeRelativeBaseOffset(p *Program, args []int) error {
+	if p.arithmetic != WrappingArithmetic {
+		if p.isBig(0) {
+			return p.overflow(0)
+		}
+		base, ok := addInts(p.RelativeBase(), args[0])
+		if !ok {
+			return p.overflow(-1)
+		}
+		p.SetRelativeBase(base)
+		return nil
+	}
+	p.SetRelativeBase(p.RelativeBase() + args[0])
+	return nil
+}
+
+func executeHalt(p *Program, args []int) error {
+	return p.Halt()
+}
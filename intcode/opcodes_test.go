@@ -0,0 +1,161 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// customSet has INC, reading an input and storing it plus one, and JNZ,
+// a copy of JT with another opcode
+func customSet(t *testing.T) *InstructionSet {
+	t.Helper()
+	s := NewInstructionSet()
+	err := s.Register(Opcode{Code: 42, Mnemonic: "INC", Params: []ParamRole{Write}, Handler: func(p *Program, args []int) error {
+		v, err := p.ReadInput()
+		if err != nil {
+			return err
+		}
+		p.Store(args[0], v+1)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jt, _ := s.Lookup(5)
+	jt.Code, jt.Mnemonic = 50, "JNZ"
+	if err := s.Register(jt); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCustomInputOpcode(t *testing.T) {
+	s := customSet(t)
+	p := ProgramCreator([]int{42, 5, 4, 5, 99, 0}, WithInstructionSet(s))()
+
+	if status := p.Resume(); status.Kind != NeedInput {
+		t.Fatalf("got %v, want need input", status)
+	}
+	snapshot := p.Snapshot()
+
+	p.Feed(5)
+	if status := p.Resume(); status.Kind != HasOutput || status.Value != 6 {
+		t.Fatalf("got %v, want output(6)", status)
+	}
+
+	restored := snapshot.Restore(WithInstructionSet(s))
+	restored.Feed(7)
+	if status := restored.Resume(); status.Kind != HasOutput || status.Value != 8 {
+		t.Fatalf("restored: got %v, want output(8)", status)
+	}
+
+	status := snapshot.Restore().Resume()
+	var fault *Fault
+	if status.Kind != Error || !errors.As(status.Err, &fault) || fault.Kind != UnknownOpcode {
+		t.Fatalf("restored without the instruction set: got %v, want an unknown opcode fault", status)
+	}
+}
+
+func TestCustomJumpFallsThrough(t *testing.T) {
+	s := customSet(t)
+	for _, test := range []struct {
+		memory []int
+		want   bool
+	}{
+		{[]int{1150, 1, 0}, false},
+		{[]int{1150, 0, 0}, true},
+		{[]int{1050, 1, 0}, true},
+	} {
+		inst, err := s.Decode(test.memory, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := inst.FallsThrough(); got != test.want {
+			t.Errorf("%v: got %v, want %v", inst, got, test.want)
+		}
+	}
+}
+
+func TestExecuteWrappers(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		memory  []int
+		execute func(p *Program) error
+		address int
+		want    int
+	}{
+		{"add", []int{1, 5, 6, 7, 99, 3, 4, 0}, (*Program).ExecuteAdd, 7, 7},
+		{"multiply", []int{1102, 3, 4, 5, 99, 0}, (*Program).ExecuteMultiply, 5, 12},
+		{"less than", []int{1107, 3, 4, 5, 99, 0}, (*Program).ExecuteLessThan, 5, 1},
+		{"equals", []int{1108, 3, 4, 5, 99, 0}, (*Program).ExecuteEquals, 5, 0},
+	} {
+		p := ProgramCreator(test.memory)()
+		if err := test.execute(p); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if got := p.MemoryAt(test.address); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		if p.instrPtr != 4 {
+			t.Errorf("%v: instruction pointer %v, want 4", test.name, p.instrPtr)
+		}
+	}
+}
+
+func TestProfileCustomInput(t *testing.T) {
+	p := ProgramCreator([]int{42, 5, 4, 5, 99, 0}, WithInstructionSet(customSet(t)))()
+	pr := NewProfiler()
+	p.SetProfiler(pr)
+	if err := p.RunIO(nil, SliceInput(5), &SliceOutput{}); err != nil {
+		t.Fatal(err)
+	}
+	if pr.Inputs != 1 || pr.Outputs != 1 || pr.Opcodes[42] != 1 {
+		t.Errorf("got %v inputs, %v outputs and %v INC, want 1, 1 and 1", pr.Inputs, pr.Outputs, pr.Opcodes[42])
+	}
+}
+
+func TestDebuggerCustomInput(t *testing.T) {
+	p := ProgramCreator([]int{42, 5, 4, 5, 99, 0}, WithInstructionSet(customSet(t)))()
+	var w bytes.Buffer
+	d := NewDebugger(p, strings.NewReader("s 2\n41\n"), &w)
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.String(), "input> ") || !strings.Contains(w.String(), "output: 42") {
+		t.Errorf("got %q, want a prompt for the input and output: 42", w.String())
+	}
+}
+
+func TestRewindToCustomWrite(t *testing.T) {
+	// SWAP exchanges two cells with a single instruction
+	s := NewInstructionSet()
+	err := s.Register(Opcode{Code: 60, Mnemonic: "SWAP", Params: []ParamRole{Write, Write}, Handler: func(p *Program, args []int) error {
+		a, b := p.MemoryAt(args[0]), p.MemoryAt(args[1])
+		p.Store(args[0], b)
+		p.Store(args[1], a)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := ProgramCreator([]int{60, 7, 8, 1101, 0, 0, 9, 1, 2, 0, 99}, WithInstructionSet(s))()
+	p.SetHistory(NewHistory(0, 0))
+	for i := 0; i < 2; i++ {
+		if err := p.ExecuteNextInstruction(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, address := range []int{8, 7} {
+		ip, err := p.RewindToLastWrite(address)
+		if err != nil {
+			t.Fatalf("address %v: %v", address, err)
+		}
+		if ip != 0 || p.MemoryAt(7) != 1 || p.MemoryAt(8) != 2 {
+			t.Errorf("address %v: got ip %v and %v, want ip 0 and [1 2]", address, ip, p.MemorySlice(7, 9))
+		}
+		p.ExecuteNextInstruction()
+	}
+}
@@ -0,0 +1,308 @@
+package intcode
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Profiler counts what a Program executes
+type Profiler struct {
+	Steps int
+	// Opcodes counts executions by opcode
+	Opcodes map[int]int
+	// Addresses counts executions by instruction address
+	Addresses map[int]int
+	// Reads and Writes count memory accesses of parameters by address
+	Reads  map[int]int
+	Writes map[int]int
+	// Inputs and Outputs count the values read and written by the program,
+	// whatever the opcodes reading and writing them
+	Inputs  int
+	Outputs int
+
+	// codes keeps the last instruction seen at each address for reports
+	codes map[int]int
+	// names are the mnemonics of the opcodes executed
+	names   map[int]string
+	pending profileAccess
+}
+
+// profileAccess describes the instruction about to be executed
+type profileAccess struct {
+	ip, code int
+	op       *Opcode
+	reads    [maxParams]int
+	nreads   int
+	write    int
+}
+
+// NewProfiler creates an empty profiler
+func NewProfiler() *Profiler {
+	return &Profiler{
+		Opcodes:   make(map[int]int),
+		Addresses: make(map[int]int),
+		Reads:     make(map[int]int),
+		Writes:    make(map[int]int),
+		codes:     make(map[int]int),
+		names:     make(map[int]string),
+	}
+}
+
+// SetProfiler attaches a profiler to the program, nil detaches it
+func (p *Program) SetProfiler(pr *Profiler) {
+	p.profiler = pr
+}
+
+// before looks at the memory accessed by the next instruction
+// it returns false if the instruction can't be executed, the execution reports why
+func (pr *Profiler) before(p *Program) bool {
+	return pr.pending.look(p)
+}
+
+// look finds the memory accessed by the instruction at the instruction pointer
+// it returns false if the instruction can't be executed
+func (access *profileAccess) look(p *Program) bool {
+	ip := p.instrPtr
+	code := p.mem.at(ip)
+	info := p.instructions.lookup(code % 100)
+	if info == nil {
+		return false
+	}
+
+	access.ip, access.code, access.op = ip, code, info
+	access.nreads, access.write = 0, -1
+	for i := range info.Params {
+		address := p.mem.at(ip + i + 1)
+		switch paramMode(code, i) {
+		case positionMode:
+		case relativeMode:
+			address += p.relativeBase
+		default:
+			continue
+		}
+		if address < 0 {
+			return false
+		}
+		if i == info.write {
+			access.write = address
+		} else {
+			access.reads[access.nreads] = address
+			access.nreads++
+		}
+	}
+	return true
+}
+
+// after counts the instruction once it is executed
+func (pr *Profiler) after() {
+	access := &pr.pending
+	opcode := access.code % 100
+	pr.Steps++
+	pr.Opcodes[opcode]++
+	pr.Addresses[access.ip]++
+	pr.codes[access.ip] = access.code
+	if _, found := pr.names[opcode]; !found {
+		pr.names[opcode] = access.op.Mnemonic
+	}
+	for _, address := range access.reads[:access.nreads] {
+		pr.Reads[address]++
+	}
+	if access.write >= 0 {
+		pr.Writes[access.write]++
+	}
+}
+
+// Merge adds the counts of other to the profiler
+func (pr *Profiler) Merge(other *Profiler) {
+	pr.Steps += other.Steps
+	pr.Inputs += other.Inputs
+	pr.Outputs += other.Outputs
+	for k, v := range other.Opcodes {
+		pr.Opcodes[k] += v
+	}
+	for k, v := range other.Addresses {
+		pr.Addresses[k] += v
+	}
+	for k, v := range other.Reads {
+		pr.Reads[k] += v
+	}
+	for k, v := range other.Writes {
+		pr.Writes[k] += v
+	}
+	for k, v := range other.codes {
+		pr.codes[k] = v
+	}
+	for k, v := range other.names {
+		pr.names[k] = v
+	}
+}
+
+// mnemonic names the instruction last executed at ip
+func (pr *Profiler) mnemonic(ip int) string {
+	return pr.names[pr.codes[ip]%100]
+}
+
+// profileCount is a counter of a profile map
+type profileCount struct {
+	key, count int
+}
+
+// hottest sorts the counts of m, the highest first, and keeps the top n ones
+// all counts are kept when n is not positive
+func hottest(m map[int]int, n int) []profileCount {
+	result := make([]profileCount, 0, len(m))
+	for k, v := range m {
+		result = append(result, profileCount{k, v})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].key < result[j].key
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// WriteReport writes a text report of the top hot spots of each kind
+func (pr *Profiler) WriteReport(w io.Writer, top int) error {
+	bw := bufio.NewWriter(w)
+	percent := func(count int) float64 {
+		if pr.Steps == 0 {
+			return 0
+		}
+		return 100 * float64(count) / float64(pr.Steps)
+	}
+
+	fmt.Fprintf(bw, "steps: %v, inputs: %v, outputs: %v\n", pr.Steps, pr.Inputs, pr.Outputs)
+
+	fmt.Fprintln(bw, "\nopcodes:")
+	for _, c := range hottest(pr.Opcodes, 0) {
+		fmt.Fprintf(bw, "  %-4v %12v %6.2f%%\n", pr.names[c.key], c.count, percent(c.count))
+	}
+
+	fmt.Fprintln(bw, "\nhot instructions:")
+	for _, c := range hottest(pr.Addresses, top) {
+		fmt.Fprintf(bw, "  %04d %-4v %12v %6.2f%%\n", c.key, pr.mnemonic(c.key), c.count, percent(c.count))
+	}
+
+	fmt.Fprintln(bw, "\nhot reads:")
+	for _, c := range hottest(pr.Reads, top) {
+		fmt.Fprintf(bw, "  %04d %12v\n", c.key, c.count)
+	}
+
+	fmt.Fprintln(bw, "\nhot writes:")
+	for _, c := range hottest(pr.Writes, top) {
+		fmt.Fprintf(bw, "  %04d %12v\n", c.key, c.count)
+	}
+	return bw.Flush()
+}
+
+// WritePprof writes a gzipped pprof profile with one location per instruction address
+// the sample type is executions, each sample is labelled with its opcode
+func (pr *Profiler) WritePprof(w io.Writer) error {
+	table := []string{""}
+	index := make(map[string]int)
+	str := func(s string) uint64 {
+		if idx, found := index[s]; found {
+			return uint64(idx)
+		}
+		index[s] = len(table)
+		table = append(table, s)
+		return uint64(len(table) - 1)
+	}
+
+	var profile protoBuffer
+	var msg protoBuffer
+	msg.varint(1, str("executions"))
+	msg.varint(2, str("count"))
+	profile.message(1, &msg)
+
+	counts := hottest(pr.Addresses, 0)
+	for i, c := range counts {
+		id := uint64(i + 1)
+		mnemonic := pr.mnemonic(c.key)
+
+		// sample
+		var label protoBuffer
+		label.varint(1, str("opcode"))
+		label.varint(2, str(mnemonic))
+		msg = protoBuffer{}
+		msg.packed(1, id)
+		msg.packed(2, uint64(c.count))
+		msg.message(3, &label)
+		profile.message(2, &msg)
+
+		// location
+		var line protoBuffer
+		line.varint(1, id)
+		line.varint(2, uint64(c.key))
+		msg = protoBuffer{}
+		msg.varint(1, id)
+		msg.varint(3, uint64(c.key))
+		msg.message(4, &line)
+		profile.message(4, &msg)
+
+		// function
+		name := str(fmt.Sprintf("%04d %v", c.key, mnemonic))
+		msg = protoBuffer{}
+		msg.varint(1, id)
+		msg.varint(2, name)
+		msg.varint(3, name)
+		msg.varint(4, str("intcode"))
+		msg.varint(5, uint64(c.key))
+		profile.message(5, &msg)
+	}
+
+	for _, s := range table {
+		profile.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.buf); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes the few protocol buffer wire types a pprof profile needs
+type protoBuffer struct {
+	buf []byte
+}
+
+func (b *protoBuffer) uvarint(v uint64) {
+	for v >= 0x80 {
+		b.buf = append(b.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	b.buf = append(b.buf, byte(v))
+}
+
+func (b *protoBuffer) varint(field int, v uint64) {
+	b.uvarint(uint64(field) << 3)
+	b.uvarint(v)
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.uvarint(uint64(field)<<3 | 2)
+	b.uvarint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+func (b *protoBuffer) message(field int, msg *protoBuffer) {
+	b.bytes(field, msg.buf)
+}
+
+// packed writes a repeated field of varints
+func (b *protoBuffer) packed(field int, values ...uint64) {
+	var p protoBuffer
+	for _, v := range values {
+		p.uvarint(v)
+	}
+	b.bytes(field, p.buf)
+}
@@ -0,0 +1,35 @@
+package intcode
+
+import "testing"
+
+func TestProfiler(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []int
+		inputs  []int
+		steps   int
+		inputsN int
+		outputs int
+		opcodes map[int]int
+	}{
+		{"echo", []int{3, 9, 4, 9, 1105, 0, 0, 99, 0, 0}, []int{42}, 4, 1, 1, map[int]int{3: 1, 4: 1, 5: 1, 99: 1}},
+		{"quine", []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}, nil, 81, 0, 16,
+			map[int]int{9: 16, 4: 16, 1: 16, 8: 16, 6: 16, 99: 1}},
+	} {
+		p := ProgramCreator(test.program)()
+		pr := NewProfiler()
+		p.SetProfiler(pr)
+		if err := p.RunIO(nil, SliceInput(test.inputs...), &SliceOutput{}); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if pr.Steps != test.steps || pr.Inputs != test.inputsN || pr.Outputs != test.outputs {
+			t.Errorf("%v: got %v steps, %v inputs and %v outputs, want %v, %v and %v",
+				test.name, pr.Steps, pr.Inputs, pr.Outputs, test.steps, test.inputsN, test.outputs)
+		}
+		for opcode, want := range test.opcodes {
+			if got := pr.Opcodes[opcode]; got != want {
+				t.Errorf("%v: opcode %v executed %v times, want %v", test.name, opcode, got, want)
+			}
+		}
+	}
+}
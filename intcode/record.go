@@ -0,0 +1,194 @@
+package intcode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// IOEvent is a value read or written by a program
+type IOEvent struct {
+	// Step is the number of instructions executed before the one reading or writing
+	Step  int       `json:"step"`
+	Kind  EventKind `json:"kind"`
+	Value int       `json:"value"`
+	// Big is the decimal value of an output which doesn't fit in an int, see WithArithmetic
+	Big string `json:"big,omitempty"`
+}
+
+func (e IOEvent) String() string {
+	if e.Kind == HaltEvent {
+		return fmt.Sprintf("halt at step %v", e.Step)
+	}
+	if e.Big != "" {
+		return fmt.Sprintf("%v %v at step %v", e.Kind, e.Big, e.Step)
+	}
+	return fmt.Sprintf("%v %v at step %v", e.Kind, e.Value, e.Step)
+}
+
+// Recording is what is needed to replay a program without its driver
+type Recording struct {
+	// Program is the memory of the program when it started, patches included
+	Program []int
+	Events  []IOEvent
+}
+
+// recordingHeader is the first line of a recording file
+type recordingHeader struct {
+	Program []int `json:"program"`
+}
+
+// Recorder writes the values read and written by a program as JSON Lines:
+// a header with the program, then one line per event
+// every line is written as soon as it is known, so a crash keeps the recording
+type Recorder struct {
+	enc     *json.Encoder
+	started bool
+	steps   int
+	events  int
+
+	// replay is set when the events are checked instead of written
+	replay *Recording
+}
+
+// NewRecorder creates a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// SetRecorder attaches a recorder to the program, nil detaches it
+func (p *Program) SetRecorder(r *Recorder) {
+	p.recorder = r
+}
+
+// before writes the header when the first instruction is about to be executed
+// so the memory patched by the driver, like day13 quarters, is recorded
+func (r *Recorder) before(p *Program) error {
+	if r.started {
+		return nil
+	}
+	r.started = true
+	return r.enc.Encode(recordingHeader{Program: p.MemorySlice(0, p.programLen)})
+}
+
+// record writes, or checks when replaying, an event of the current instruction
+func (r *Recorder) record(kind EventKind, v int) error {
+	return r.write(IOEvent{Kind: kind, Value: v})
+}
+
+// write writes, or checks when replaying, an event at the current step
+func (r *Recorder) write(e IOEvent) error {
+	e.Step = r.steps
+	if r.replay != nil {
+		if err := r.check(e); err != nil {
+			return err
+		}
+	} else if err := r.enc.Encode(e); err != nil {
+		return err
+	}
+	r.events++
+	return nil
+}
+
+// errReplayEnd stops a replay once every recorded event is reproduced
+var errReplayEnd = errors.New("end of the recording")
+
+// DivergenceError is returned when a replayed program does not behave as recorded
+type DivergenceError struct {
+	// Index is the position of the first event not reproduced
+	Index    int
+	Expected IOEvent
+	// Got is what the program did instead
+	Got IOEvent
+}
+
+func (e *DivergenceError) Error() string {
+	if e.Got.Kind == InputEvent && e.Expected.Kind != InputEvent {
+		return fmt.Sprintf("replay diverges at event %v: the program reads at step %v, expected %v",
+			e.Index, e.Got.Step, e.Expected)
+	}
+	return fmt.Sprintf("replay diverges at event %v: got %v, expected %v", e.Index, e.Got, e.Expected)
+}
+
+// check compares e with the recorded event
+func (r *Recorder) check(e IOEvent) error {
+	if r.events >= len(r.replay.Events) {
+		return errReplayEnd
+	}
+	if expected := r.replay.Events[r.events]; e != expected {
+		return &DivergenceError{Index: r.events, Expected: expected, Got: e}
+	}
+	return nil
+}
+
+// replayInput gives the program the recorded inputs
+type replayInput struct {
+	r *Recorder
+}
+
+func (in replayInput) Read() (int, error) {
+	r := in.r
+	if r.events >= len(r.replay.Events) {
+		return 0, errReplayEnd
+	}
+	expected := r.replay.Events[r.events]
+	if expected.Kind != InputEvent {
+		return 0, &DivergenceError{Index: r.events, Expected: expected, Got: IOEvent{Step: r.steps, Kind: InputEvent}}
+	}
+	return expected.Value, nil
+}
+
+// ReadRecording reads a recording written by a Recorder
+func ReadRecording(r io.Reader) (*Recording, error) {
+	dec := json.NewDecoder(r)
+	var header recordingHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("invalid recording header: %v", err)
+	}
+
+	rec := &Recording{Program: header.Program}
+	for {
+		var e IOEvent
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return rec, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recording event %v: %v", len(rec.Events), err)
+		}
+		rec.Events = append(rec.Events, e)
+	}
+}
+
+// Replay executes the recorded program, feeding it the recorded inputs,
+// and checks it writes the recorded outputs at the same steps
+// outputs are written to out, which may be nil, and must be a BigOutput
+// if some of them don't fit in an int
+// it returns a *DivergenceError at the first difference, and nil once
+// every event is reproduced, even if the program would go on
+func (rec *Recording) Replay(ctx context.Context, out Output) error {
+	var options []Option
+	for _, e := range rec.Events {
+		if e.Big != "" {
+			// large outputs were only written with the big arithmetic
+			options = append(options, WithArithmetic(BigArithmetic))
+			break
+		}
+	}
+	p := ProgramCreator(rec.Program, options...)()
+	// the program is already patched, there is no header to write
+	r := &Recorder{replay: rec, started: true}
+	p.SetRecorder(r)
+	if out == nil {
+		out = OutputFunc(func(int) error { return nil })
+	}
+
+	// an unexpected halt is reported by check
+	err := p.RunIO(ctx, replayInput{r}, out)
+	if err == errReplayEnd {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package intcode
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordEcho records echo reading 5, 6 then 0
+func recordEcho(t *testing.T) *Recording {
+	t.Helper()
+	var b bytes.Buffer
+	p := ProgramCreator(echo)()
+	p.SetRecorder(NewRecorder(&b))
+	if err := p.RunIO(nil, SliceInput(5, 6, 0), &SliceOutput{}); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := ReadRecording(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestReplay(t *testing.T) {
+	rec := recordEcho(t)
+	kinds := make([]EventKind, len(rec.Events))
+	for i, e := range rec.Events {
+		kinds[i] = e.Kind
+	}
+	want := []EventKind{InputEvent, OutputEvent, InputEvent, OutputEvent, InputEvent, HaltEvent}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("got %v, want %v", kinds, want)
+	}
+
+	out := &SliceOutput{}
+	if err := rec.Replay(nil, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Values, []int{5, 6}) {
+		t.Errorf("got %v, want [5 6]", out.Values)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(rec *Recording)
+		index  int
+		got    IOEvent
+		reads  bool
+	}{
+		{"output", func(rec *Recording) { rec.Events[3].Value = 7 }, 3, IOEvent{Step: 6, Kind: OutputEvent, Value: 6}, false},
+		{"program", func(rec *Recording) { rec.Program[6] = 12 }, 1, IOEvent{Step: 2, Kind: OutputEvent, Value: 0}, false},
+		{"missing input", func(rec *Recording) { rec.Events = rec.Events[1:] }, 0, IOEvent{Step: 0, Kind: InputEvent}, true},
+	} {
+		rec := recordEcho(t)
+		test.change(rec)
+		err := rec.Replay(nil, nil)
+		d, ok := err.(*DivergenceError)
+		if !ok {
+			t.Errorf("%v: got %v, want a divergence", test.name, err)
+			continue
+		}
+		if d.Index != test.index || d.Got != test.got {
+			t.Errorf("%v: got %v at %v, want %v at %v", test.name, d.Got, d.Index, test.got, test.index)
+		}
+		if reads := strings.Contains(err.Error(), "the program reads"); reads != test.reads {
+			t.Errorf("%v: unexpected message %q", test.name, err)
+		}
+	}
+}
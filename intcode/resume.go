@@ -0,0 +1,69 @@
+package intcode
+
+import "fmt"
+
+// StatusKind tells why Resume returned
+type StatusKind int
+
+const (
+	// NeedInput means the next instruction reads an input and none is queued,
+	// it is executed again by the next Resume
+	NeedInput StatusKind = iota
+	// HasOutput means the program produced a value
+	HasOutput
+	// Halted means the program reached its end
+	Halted
+	// Error means the execution failed
+	Error
+)
+
+// Status is the result of Resume
+type Status struct {
+	Kind StatusKind
+	// Value is the produced value when Kind is HasOutput
+	Value int
+	// Err is the failure when Kind is Error
+	Err error
+}
+
+func (s Status) String() string {
+	switch s.Kind {
+	case NeedInput:
+		return "need input"
+	case HasOutput:
+		return fmt.Sprintf("output(%v)", s.Value)
+	case Halted:
+		return "halted"
+	default:
+		return fmt.Sprintf("error(%v)", s.Err)
+	}
+}
+
+// Feed queues values for the next input instructions
+func (p *Program) Feed(values ...int) {
+	p.pendingInput = append(p.pendingInput, values...)
+}
+
+// Resume executes the program in the calling goroutine until it produces
+// an output, needs an input that has not been fed, halts or fails
+// it must not be mixed with a concurrent Run
+func (p *Program) Resume() Status {
+	// without IO, outputs are queued and inputs come from Feed
+	p.input, p.output = nil, nil
+
+	for {
+		if len(p.pendingOutput) > 0 {
+			v := p.pendingOutput[0]
+			p.pendingOutput = p.pendingOutput[1:]
+			return Status{Kind: HasOutput, Value: v}
+		}
+		if p.halted {
+			return Status{Kind: Halted}
+		}
+		if err := p.ExecuteNextInstruction(); err == ErrNoInput {
+			return Status{Kind: NeedInput}
+		} else if err != nil {
+			return Status{Kind: Error, Err: err}
+		}
+	}
+}
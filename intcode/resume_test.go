@@ -0,0 +1,54 @@
+package intcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	// reads two values and writes their sum and their product
+	p := ProgramCreator([]int{3, 17, 3, 18, 1, 17, 18, 19, 4, 19, 2, 17, 18, 19, 4, 19, 99, 0, 0, 0})()
+
+	want := []Status{
+		{Kind: NeedInput},
+		{Kind: NeedInput},
+		{Kind: HasOutput, Value: 9},
+		{Kind: HasOutput, Value: 20},
+		{Kind: Halted},
+		{Kind: Halted},
+	}
+	var got []Status
+	got = append(got, p.Resume())
+	p.Feed(4)
+	got = append(got, p.Resume())
+	p.Feed(5)
+	for i := 0; i < 4; i++ {
+		got = append(got, p.Resume())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("resume %v: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestResumeFedInAdvance(t *testing.T) {
+	// reads a value and writes it, twice
+	p := ProgramCreator([]int{3, 9, 4, 9, 3, 9, 4, 9, 99, 0})()
+	p.Feed(1, 2)
+	for _, want := range []Status{{Kind: HasOutput, Value: 1}, {Kind: HasOutput, Value: 2}, {Kind: Halted}} {
+		if got := p.Resume(); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestResumeError(t *testing.T) {
+	got := ProgramCreator([]int{42})().Resume()
+	if got.Kind != Error || got.Err == nil {
+		t.Fatalf("got %v, want an error", got)
+	}
+	if errors.Is(got.Err, ErrNoInput) {
+		t.Errorf("got %v, want an invalid opcode", got.Err)
+	}
+}
@@ -0,0 +1,192 @@
+package intcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+)
+
+const (
+	snapshotFormat  = "intcode-snapshot"
+	snapshotVersion = 2
+)
+
+// Snapshot is the complete state of a Program
+type Snapshot struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// Program is the memory loaded from the program
+	Program []int `json:"program"`
+	// ExtraMemory holds memory beyond the program, by absolute address
+	ExtraMemory map[int]int `json:"extraMemory,omitempty"`
+	// BigMemory holds the decimal values which don't fit in an int, by absolute address
+	// their cells are 0 in Program and ExtraMemory
+	BigMemory map[int]string `json:"bigMemory,omitempty"`
+	// Arithmetic is the name of the arithmetic of the program, wrapping if empty
+	Arithmetic   string `json:"arithmetic,omitempty"`
+	InstrPtr     int    `json:"instrPtr"`
+	RelativeBase int    `json:"relativeBase"`
+	Halted       bool   `json:"halted"`
+	// PendingInput are values fed but not yet read by the program
+	PendingInput []int `json:"pendingInput,omitempty"`
+	// PendingOutput are values produced but not yet delivered
+	PendingOutput []int `json:"pendingOutput,omitempty"`
+}
+
+// Snapshot captures the state of the program
+// it must not be called while the program runs in another goroutine
+func (p *Program) Snapshot() *Snapshot {
+	s := &Snapshot{
+		Format:        snapshotFormat,
+		Version:       snapshotVersion,
+		Program:       p.MemorySlice(0, p.programLen),
+		Arithmetic:    p.arithmetic.String(),
+		InstrPtr:      p.instrPtr,
+		RelativeBase:  p.relativeBase,
+		Halted:        p.halted,
+		PendingInput:  append([]int(nil), p.pendingInput...),
+		PendingOutput: append([]int(nil), p.pendingOutput...),
+	}
+	p.mem.cells(p.programLen, func(address, v int) {
+		if s.ExtraMemory == nil {
+			s.ExtraMemory = make(map[int]int)
+		}
+		s.ExtraMemory[address] = v
+	})
+	for address, v := range p.bigCells {
+		if s.BigMemory == nil {
+			s.BigMemory = make(map[int]string)
+		}
+		s.BigMemory[address] = v.String()
+	}
+	return s
+}
+
+// Restore creates a program in the state of the snapshot
+// the instruction set is not saved: a program with custom opcodes needs
+// WithInstructionSet among options, applied like by ProgramCreator
+func (s *Snapshot) Restore(options ...Option) *Program {
+	// checked by ReadSnapshot
+	arithmetic, _ := ParseArithmetic(s.Arithmetic)
+	p := &Program{
+		mem:           newMemory(s.Program),
+		programLen:    len(s.Program),
+		instrPtr:      s.InstrPtr,
+		relativeBase:  s.RelativeBase,
+		halted:        s.Halted,
+		instructions:  builtins,
+		arithmetic:    arithmetic,
+		pendingInput:  append([]int(nil), s.PendingInput...),
+		pendingOutput: append([]int(nil), s.PendingOutput...),
+	}
+	for address, v := range s.ExtraMemory {
+		p.SetMemory(address, v)
+	}
+	for address, text := range s.BigMemory {
+		// checked by ReadSnapshot
+		v, _ := new(big.Int).SetString(text, 10)
+		p.setBig(address, v)
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Clone returns a copy of the program which can be executed on its own,
+// like a fork: memory pages are shared until one of them writes it
+// the clone keeps the limits and the monitor but not the IO nor the other
+// attached tools, like a tracer
+// it must not be called while the program runs in another goroutine
+func (p *Program) Clone() *Program {
+	c := &Program{
+		mem:           p.mem.clone(),
+		programLen:    p.programLen,
+		instrPtr:      p.instrPtr,
+		halted:        p.halted,
+		relativeBase:  p.relativeBase,
+		instructions:  p.instructions,
+		arithmetic:    p.arithmetic,
+		monitor:       p.monitor,
+		pendingInput:  append([]int(nil), p.pendingInput...),
+		pendingOutput: append([]int(nil), p.pendingOutput...),
+	}
+	// values are never changed once stored, they can be shared
+	for address, v := range p.bigCells {
+		c.setBig(address, v)
+	}
+	if p.limit != nil {
+		limit := *p.limit
+		c.limit = &limit
+	}
+	return c
+}
+
+// Write writes the snapshot as JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return enc.Encode(s)
+}
+
+// Save writes the snapshot in a file
+func (s *Snapshot) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSnapshot reads a snapshot written by Write
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Format != snapshotFormat {
+		return nil, fmt.Errorf("not an intcode snapshot")
+	}
+	if s.Version == 1 {
+		// the arithmetic was not saved, only big values tell it
+		s.Version, s.Arithmetic = snapshotVersion, WrappingArithmetic.String()
+		if len(s.BigMemory) > 0 {
+			s.Arithmetic = BigArithmetic.String()
+		}
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %v", s.Version)
+	}
+	if _, ok := ParseArithmetic(s.Arithmetic); !ok && s.Arithmetic != "" {
+		return nil, fmt.Errorf("unknown arithmetic %q", s.Arithmetic)
+	}
+	if len(s.BigMemory) > 0 && s.Arithmetic != BigArithmetic.String() {
+		return nil, fmt.Errorf("values which don't fit in an int with the %v arithmetic", s.Arithmetic)
+	}
+	for address := range s.ExtraMemory {
+		if address < len(s.Program) {
+			return nil, fmt.Errorf("extra memory address %v overlaps the program", address)
+		}
+	}
+	for address, text := range s.BigMemory {
+		if _, ok := new(big.Int).SetString(text, 10); !ok {
+			return nil, fmt.Errorf("invalid value %q at address %v", text, address)
+		}
+	}
+	return &s, nil
+}
+
+// LoadSnapshot reads a snapshot saved in a file
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
@@ -0,0 +1,132 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// saveAndRestore writes the snapshot of p, reads it back and restores it
+func saveAndRestore(t *testing.T, p *Program) *Program {
+	t.Helper()
+	var b bytes.Buffer
+	if err := p.Snapshot().Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSnapshot(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Restore()
+}
+
+func TestSnapshotArithmetic(t *testing.T) {
+	// the first product fits in an int, the second doesn't
+	program := []int{1102, 3037000499, 3037000499, 20, 1002, 20, 4, 20, 4, 20, 99}
+
+	for _, a := range []Arithmetic{CheckedArithmetic, BigArithmetic} {
+		t.Run(a.String(), func(t *testing.T) {
+			p := ProgramCreator(program, WithArithmetic(a))()
+			if err := p.ExecuteNextInstruction(); err != nil {
+				t.Fatal(err)
+			}
+			restored := saveAndRestore(t, p)
+
+			out := &BigSliceOutput{}
+			err := restored.RunIO(nil, nil, out)
+			switch a {
+			case CheckedArithmetic:
+				var fault *Fault
+				if !errors.As(err, &fault) || fault.Kind != Overflow {
+					t.Errorf("got %v, want an overflow fault", err)
+				}
+			case BigArithmetic:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out.Values) != 1 || out.Values[0].String() != "36893488123704996004" {
+					t.Errorf("got %v, want 36893488123704996004", out.Values)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotSameOutputs(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []int
+		inputs  []int
+	}{
+		{"quine", []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}, nil},
+		{"equal to 8", []int{3, 9, 8, 9, 10, 9, 4, 9, 99, -1, 8}, []int{8}},
+		{"compared to 8", []int{3, 21, 1008, 21, 8, 20, 1005, 20, 22, 107, 8, 21, 20, 1006, 20, 31,
+			1106, 0, 36, 98, 0, 0, 1002, 21, 125, 20, 4, 20, 1105, 1, 46, 104,
+			999, 1105, 1, 46, 1101, 1000, 1, 20, 4, 20, 1105, 1, 46, 98, 99}, []int{7}},
+	} {
+		want := &SliceOutput{}
+		if err := ProgramCreator(test.program)().RunIO(nil, SliceInput(test.inputs...), want); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		// save the program after every instruction, the restored one must end the same way
+		for steps := 0; ; steps++ {
+			p := ProgramCreator(test.program)()
+			p.Feed(test.inputs...)
+			for i := 0; i < steps && !p.halted; i++ {
+				if err := p.ExecuteNextInstruction(); err != nil {
+					t.Fatalf("%v: %v", test.name, err)
+				}
+			}
+			halted := p.halted
+
+			got := &SliceOutput{}
+			if err := saveAndRestore(t, p).RunIO(nil, nil, got); err != nil {
+				t.Fatalf("%v, saved after %v steps: %v", test.name, steps, err)
+			}
+			if !reflect.DeepEqual(got.Values, want.Values) {
+				t.Errorf("%v, saved after %v steps: got %v, want %v", test.name, steps, got.Values, want.Values)
+			}
+			if halted {
+				break
+			}
+		}
+	}
+}
+
+func TestCloneIsolation(t *testing.T) {
+	// reads a value and writes it twice
+	p := ProgramCreator([]int{3, 9, 4, 9, 4, 9, 99, 0, 0, 0})()
+	// a page allocated after the program and a page out of the page table
+	p.SetMemory(5000, 1)
+	p.SetMemory(1<<40, 2)
+	p.Feed(3)
+	if got := p.Resume(); got.Kind != HasOutput || got.Value != 3 {
+		t.Fatalf("got %v, want output(3)", got)
+	}
+
+	c := p.Clone()
+	for _, address := range []int{9, 5000, 1 << 40} {
+		// the original writes first, the page is still shared
+		p.SetMemory(address+1, 20)
+		c.SetMemory(address, 10)
+		if p.MemoryAt(address) == 10 || c.MemoryAt(address+1) == 20 {
+			t.Errorf("address %v: a write is seen by the other program", address)
+		}
+	}
+	if p.MemoryAt(5000) != 1 || p.MemoryAt(1<<40) != 2 {
+		t.Errorf("got %v and %v, want 1 and 2", p.MemoryAt(5000), p.MemoryAt(1<<40))
+	}
+
+	// both go on from the same state with their own memory
+	if got := c.Resume(); got.Kind != HasOutput || got.Value != 10 {
+		t.Errorf("clone: got %v, want output(10)", got)
+	}
+	if got := p.Resume(); got.Kind != HasOutput || got.Value != 3 {
+		t.Errorf("original: got %v, want output(3)", got)
+	}
+	if c.Resume().Kind != Halted || p.Resume().Kind != Halted {
+		t.Error("the programs don't halt")
+	}
+}
@@ -0,0 +1,271 @@
+// Package symbolic executes intcode programs whose inputs, and chosen memory
+// cells, are symbols instead of values, to find the values producing a result
+//
+// Values are linear expressions of the symbols. A comparison or a jump which
+// depends on symbols forks the execution into the path where its condition
+// holds and the path where it doesn't, and each path records its conditions as
+// constraints. A bounds solver then finds values of the symbols for which a
+// path produces the wanted output or memory state. Products of symbols and
+// reads through symbolic addresses can't be expressed linearly: they are
+// unknown values, which can be overwritten but not used in conditions.
+package symbolic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errors of the exploration
+var (
+	ErrUnsupported  = errors.New("unsupported by symbolic execution")
+	ErrTooManyPaths = errors.New("too many paths")
+	ErrNoSolution   = errors.New("no solution")
+)
+
+// symbolInfo names a symbol and bounds its values
+type symbolInfo struct {
+	name   string
+	domain interval
+	// input is the index of the value read, -1 for memory cells
+	input int
+}
+
+// Engine explores the paths of an intcode program
+type Engine struct {
+	// InputMin and InputMax bound the values read by the program
+	InputMin, InputMax int
+	// MaxPaths bounds the number of paths explored, MaxSteps the number of
+	// instructions executed by path, 0 means no limit
+	MaxPaths int
+	MaxSteps int
+
+	program []int
+	symbols []symbolInfo
+	memory  map[int]Symbol
+	// inputs are the symbols of the values read, in order
+	inputs []Symbol
+}
+
+// New creates an engine for program, where only inputs are symbols
+func New(program []int) *Engine {
+	return &Engine{
+		InputMin: -1 << 31,
+		InputMax: 1<<31 - 1,
+		MaxPaths: 1000,
+		MaxSteps: 1000000,
+		program:  append([]int(nil), program...),
+		memory:   make(map[int]Symbol),
+	}
+}
+
+// Memory makes the cell at address a symbol between min and max
+func (e *Engine) Memory(address, min, max int) Symbol {
+	if s, found := e.memory[address]; found {
+		e.symbols[s].domain = interval{min, max}
+		return s
+	}
+	s := e.newSymbol(fmt.Sprintf("mem[%v]", address), interval{min, max}, -1)
+	e.memory[address] = s
+	return s
+}
+
+// Input returns the symbol of the value read in position n, from 0
+func (e *Engine) Input(n int) Symbol {
+	for len(e.inputs) <= n {
+		e.inputs = append(e.inputs, e.newSymbol(fmt.Sprintf("in%v", len(e.inputs)), interval{e.InputMin, e.InputMax}, len(e.inputs)))
+	}
+	return e.inputs[n]
+}
+
+func (e *Engine) newSymbol(name string, domain interval, input int) Symbol {
+	e.symbols = append(e.symbols, symbolInfo{name: name, domain: domain, input: input})
+	return Symbol(len(e.symbols) - 1)
+}
+
+// Name returns the name of a symbol, like mem[1] or in0
+func (e *Engine) Name(s Symbol) string {
+	return e.symbols[s].name
+}
+
+// Format returns the expression with the names of its symbols
+func (e *Engine) Format(x Expr) string {
+	return x.format(e.Name)
+}
+
+// FormatConstraint returns the constraint with the names of its symbols
+func (e *Engine) FormatConstraint(c Constraint) string {
+	return c.format(e.Name)
+}
+
+func (e *Engine) domains() []interval {
+	d := make([]interval, len(e.symbols))
+	for i, s := range e.symbols {
+		d[i] = s.domain
+	}
+	return d
+}
+
+// Path is an execution of the program
+type Path struct {
+	// Constraints are the conditions on the symbols to follow the path
+	Constraints []Constraint
+	Outputs     []Expr
+	// Inputs is the number of values read
+	Inputs int
+	Halted bool
+	// Err tells why the path ended before halting
+	Err error
+
+	state *state
+}
+
+// MemoryAt returns the value of a memory cell at the end of the path
+func (p *Path) MemoryAt(address int) Expr {
+	return p.state.read(address)
+}
+
+// Explore executes every path of the program, the shortest first
+// the paths explored are returned with ErrTooManyPaths when MaxPaths is reached
+func (e *Engine) Explore() ([]*Path, error) {
+	var paths []*Path
+	err := e.explore(func(p *Path) (bool, error) {
+		paths = append(paths, p)
+		return false, nil
+	})
+	return paths, err
+}
+
+// explore gives every path to visit until it returns true or an error
+// states run until they fork then wait in a queue, so shorter paths end first
+func (e *Engine) explore(visit func(p *Path) (bool, error)) error {
+	queue := []*state{e.initial()}
+	created := 1
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		var fork *state
+		halted := false
+		for s.err == nil && !halted && fork == nil {
+			fork, halted, s.err = e.step(s)
+		}
+		if fork != nil {
+			if e.MaxPaths > 0 && created >= e.MaxPaths {
+				return fmt.Errorf("%w: %v paths explored", ErrTooManyPaths, created)
+			}
+			created++
+			queue = append(queue, s, fork)
+			continue
+		}
+
+		p := &Path{Constraints: s.constraints, Outputs: s.outputs, Inputs: s.inputs, Halted: halted, Err: s.err, state: s}
+		if stop, err := visit(p); stop || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Target selects the value of a path to solve for, ok is false if the path has none
+type Target func(p *Path) (x Expr, ok bool)
+
+// MemoryTarget is the value of a memory cell once the program halted
+func MemoryTarget(address int) Target {
+	return func(p *Path) (Expr, bool) {
+		if !p.Halted {
+			return Expr{}, false
+		}
+		return p.MemoryAt(address), true
+	}
+}
+
+// OutputTarget is the nth value written, from 0, or from the end if n is negative
+// outputs from the end are only known once the program halted
+func OutputTarget(n int) Target {
+	return func(p *Path) (Expr, bool) {
+		i := n
+		if i < 0 {
+			i += len(p.Outputs)
+			if !p.Halted {
+				return Expr{}, false
+			}
+		}
+		if i < 0 || i >= len(p.Outputs) {
+			return Expr{}, false
+		}
+		return p.Outputs[i], true
+	}
+}
+
+// Solution is the values of the symbols reaching a target
+type Solution struct {
+	// Path is the execution reaching the target
+	Path *Path
+
+	engine *Engine
+	values []int
+}
+
+// Value returns the value of a symbol
+func (s *Solution) Value(sym Symbol) int {
+	return s.values[sym]
+}
+
+// Inputs returns the values read by the path
+func (s *Solution) Inputs() []int {
+	inputs := make([]int, s.Path.Inputs)
+	for i := range inputs {
+		inputs[i] = s.values[s.engine.inputs[i]]
+	}
+	return inputs
+}
+
+func (s *Solution) String() string {
+	var parts []string
+	for i, info := range s.engine.symbols {
+		if info.input < s.Path.Inputs {
+			parts = append(parts, fmt.Sprintf("%v=%v", info.name, s.values[i]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Solve explores the paths of the program until it finds values of the
+// symbols for which target equals want
+func (e *Engine) Solve(target Target, want int) (*Solution, error) {
+	var solution *Solution
+	var failures []string
+	err := e.explore(func(p *Path) (bool, error) {
+		x, ok := target(p)
+		if !ok {
+			if p.Err != nil && errors.Is(p.Err, ErrUnsupported) {
+				failures = append(failures, p.Err.Error())
+			}
+			return false, nil
+		}
+		if known, reason := x.Known(); !known {
+			failures = append(failures, "target is unknown: "+reason)
+			return false, nil
+		}
+		values, found, err := solve(e.domains(), append(p.Constraints[:len(p.Constraints):len(p.Constraints)], Eq(x, Const(want))))
+		if err != nil {
+			failures = append(failures, err.Error())
+			return false, nil
+		}
+		if found {
+			solution = &Solution{Path: p, engine: e, values: values}
+		}
+		return found, nil
+	})
+	if solution != nil {
+		return solution, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("%w for %v, %v paths couldn't be solved, first: %v", ErrNoSolution, want, len(failures), failures[0])
+	}
+	return nil, fmt.Errorf("%w for %v", ErrNoSolution, want)
+}
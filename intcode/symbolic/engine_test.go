@@ -0,0 +1,51 @@
+package symbolic
+
+import (
+	"errors"
+	"testing"
+)
+
+// gravityAssist is a day 2 program, where the cell 0 ends up as 34560*noun + verb + 59855
+var gravityAssist = []int{
+	1, 0, 0, 3, 1, 1, 2, 3, 1, 3, 4, 3, 1, 5, 0, 3,
+	2, 1, 10, 19, 1, 6, 19, 23, 1, 10, 23, 27, 2, 27, 13, 31,
+	1, 31, 6, 35, 2, 6, 35, 39, 1, 39, 5, 43, 1, 6, 43, 47,
+	2, 6, 47, 51, 1, 51, 5, 55, 2, 55, 9, 59, 1, 6, 59, 63,
+	1, 9, 63, 67, 1, 67, 10, 71, 2, 9, 71, 75, 1, 6, 75, 79,
+	1, 5, 79, 83, 2, 83, 10, 87, 1, 87, 5, 91, 1, 91, 9, 95,
+	1, 6, 95, 99, 2, 99, 10, 103, 1, 10, 103, 107, 2, 107, 9, 111,
+	1, 111, 5, 115, 1, 115, 4, 119, 1, 119, 9, 123, 1, 5, 123, 127,
+	1, 127, 10, 131, 1, 131, 2, 135, 1, 135, 5, 0, 99, 2, 14, 0,
+	0,
+}
+
+func TestSolveNounVerb(t *testing.T) {
+	for _, test := range []struct {
+		objective  int
+		noun, verb int
+		err        error
+	}{
+		{474577, 12, 2, nil},
+		{1511392, 42, 17, nil},
+		{3481394, 99, 99, nil},
+		{59855, 0, 0, nil},
+		{59854, 0, 0, ErrNoSolution},
+	} {
+		e := New(gravityAssist)
+		noun := e.Memory(1, 0, 99)
+		verb := e.Memory(2, 0, 99)
+		solution, err := e.Solve(MemoryTarget(0), test.objective)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%v: got %v, want %v", test.objective, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", test.objective, err)
+		}
+		if n, v := solution.Value(noun), solution.Value(verb); n != test.noun || v != test.verb {
+			t.Errorf("%v: got noun %v and verb %v, want %v and %v", test.objective, n, v, test.noun, test.verb)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package symbolic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Symbol is an unknown value of the program, an input or a memory cell
+type Symbol int
+
+// term is a symbol multiplied by a coefficient
+type term struct {
+	symbol Symbol
+	coeff  int
+}
+
+// Expr is a linear expression of symbols: a constant plus terms
+// an Expr may also be unknown, when it can't be expressed linearly
+type Expr struct {
+	constant int
+	// terms are sorted by symbol, coefficients are never 0
+	terms []term
+	// unknown tells why the value can't be expressed, empty if it can
+	unknown string
+}
+
+// Const returns the expression of a constant
+func Const(v int) Expr {
+	return Expr{constant: v}
+}
+
+// Var returns the expression of a symbol
+func Var(s Symbol) Expr {
+	return Expr{terms: []term{{symbol: s, coeff: 1}}}
+}
+
+// unknownExpr returns an expression which can't be used for solving
+func unknownExpr(format string, args ...interface{}) Expr {
+	return Expr{unknown: fmt.Sprintf(format, args...)}
+}
+
+// Known tells if the expression is linear, the reason is given if not
+func (e Expr) Known() (bool, string) {
+	return e.unknown == "", e.unknown
+}
+
+// Constant returns the value of the expression if it doesn't depend on symbols
+func (e Expr) Constant() (int, bool) {
+	return e.constant, e.unknown == "" && len(e.terms) == 0
+}
+
+// Add returns e + o
+func (e Expr) Add(o Expr) Expr {
+	return e.combine(o, 1)
+}
+
+// Sub returns e - o
+func (e Expr) Sub(o Expr) Expr {
+	return e.combine(o, -1)
+}
+
+// combine returns e + k*o
+func (e Expr) combine(o Expr, k int) Expr {
+	if e.unknown != "" {
+		return e
+	}
+	if o.unknown != "" {
+		return o
+	}
+	r := Expr{constant: e.constant + k*o.constant}
+	i, j := 0, 0
+	for i < len(e.terms) || j < len(o.terms) {
+		switch {
+		case j == len(o.terms) || (i < len(e.terms) && e.terms[i].symbol < o.terms[j].symbol):
+			r.terms = append(r.terms, e.terms[i])
+			i++
+		case i == len(e.terms) || o.terms[j].symbol < e.terms[i].symbol:
+			r.terms = append(r.terms, term{symbol: o.terms[j].symbol, coeff: k * o.terms[j].coeff})
+			j++
+		default:
+			if coeff := e.terms[i].coeff + k*o.terms[j].coeff; coeff != 0 {
+				r.terms = append(r.terms, term{symbol: e.terms[i].symbol, coeff: coeff})
+			}
+			i++
+			j++
+		}
+	}
+	return r
+}
+
+// Mul returns e * o, which is unknown if both depend on symbols
+func (e Expr) Mul(o Expr) Expr {
+	if e.unknown != "" {
+		return e
+	}
+	if o.unknown != "" {
+		return o
+	}
+	k, ok := o.Constant()
+	if !ok {
+		if k, ok = e.Constant(); !ok {
+			return unknownExpr("product of symbols")
+		}
+		e = o
+	}
+	r := Expr{constant: e.constant * k}
+	if k == 0 {
+		return r
+	}
+	for _, t := range e.terms {
+		r.terms = append(r.terms, term{symbol: t.symbol, coeff: t.coeff * k})
+	}
+	return r
+}
+
+// eval returns the value of the expression for the values of the symbols
+func (e Expr) eval(values []int) int {
+	v := e.constant
+	for _, t := range e.terms {
+		v += t.coeff * values[t.symbol]
+	}
+	return v
+}
+
+// format writes the expression with the names of the symbols
+func (e Expr) format(name func(Symbol) string) string {
+	if e.unknown != "" {
+		return "unknown (" + e.unknown + ")"
+	}
+	var b strings.Builder
+	for i, t := range e.terms {
+		coeff := t.coeff
+		switch {
+		case i > 0 && coeff < 0:
+			b.WriteString(" - ")
+			coeff = -coeff
+		case i > 0:
+			b.WriteString(" + ")
+		}
+		switch coeff {
+		case 1:
+		case -1:
+			b.WriteString("-")
+		default:
+			fmt.Fprintf(&b, "%v*", coeff)
+		}
+		b.WriteString(name(t.symbol))
+	}
+	switch {
+	case len(e.terms) == 0:
+		fmt.Fprint(&b, e.constant)
+	case e.constant < 0:
+		fmt.Fprintf(&b, " - %v", -e.constant)
+	case e.constant > 0:
+		fmt.Fprintf(&b, " + %v", e.constant)
+	}
+	return b.String()
+}
+
+// Relation compares an expression to 0
+type Relation int
+
+const (
+	// Equal is e == 0
+	Equal Relation = iota
+	// NotEqual is e != 0
+	NotEqual
+	// Less is e < 0
+	Less
+	// GreaterOrEqual is e >= 0
+	GreaterOrEqual
+)
+
+var relationSymbols = map[Relation]string{Equal: "==", NotEqual: "!=", Less: "<", GreaterOrEqual: ">="}
+
+// Constraint is a relation that the symbols must satisfy
+type Constraint struct {
+	Expr     Expr
+	Relation Relation
+}
+
+// Eq is the constraint a == b
+func Eq(a, b Expr) Constraint {
+	return Constraint{Expr: a.Sub(b), Relation: Equal}
+}
+
+// Lt is the constraint a < b
+func Lt(a, b Expr) Constraint {
+	return Constraint{Expr: a.Sub(b), Relation: Less}
+}
+
+// negate returns the opposite constraint
+func (c Constraint) negate() Constraint {
+	switch c.Relation {
+	case Equal:
+		c.Relation = NotEqual
+	case NotEqual:
+		c.Relation = Equal
+	case Less:
+		c.Relation = GreaterOrEqual
+	default:
+		c.Relation = Less
+	}
+	return c
+}
+
+// holds tells if the constraint is satisfied by the values of the symbols
+func (c Constraint) holds(values []int) bool {
+	v := c.Expr.eval(values)
+	switch c.Relation {
+	case Equal:
+		return v == 0
+	case NotEqual:
+		return v != 0
+	case Less:
+		return v < 0
+	default:
+		return v >= 0
+	}
+}
+
+func (c Constraint) format(name func(Symbol) string) string {
+	return fmt.Sprintf("%v %v 0", c.Expr.format(name), relationSymbols[c.Relation])
+}
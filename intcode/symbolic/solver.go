@@ -0,0 +1,287 @@
+package symbolic
+
+import "errors"
+
+// ErrGaveUp is returned when the solver explored too many domains without an answer
+var ErrGaveUp = errors.New("solver gave up")
+
+// maxNodes bounds the number of domains explored by a search
+const maxNodes = 200000
+
+// infinity is beyond any bound, bounds computed past it are ignored
+// the sum of two bounds must fit in an int
+const infinity = 1 << 60
+
+// interval is the domain of a symbol, bounds included
+type interval struct {
+	min, max int
+}
+
+// solver finds values of symbols satisfying constraints, by propagating the
+// bounds of the symbols then splitting their domains
+type solver struct {
+	constraints []Constraint
+	nodes       int
+}
+
+// solve returns values within domains satisfying every constraint
+// found is false if there is none, symbols not constrained take the value
+// of their domain closest to 0
+func solve(domains []interval, constraints []Constraint) (values []int, found bool, err error) {
+	s := &solver{constraints: constraints}
+	d := append([]interval(nil), domains...)
+	used := make([]bool, len(d))
+	for _, c := range constraints {
+		if c.Expr.unknown != "" {
+			return nil, false, errors.New("constraint on an unknown value: " + c.Expr.unknown)
+		}
+		for _, t := range c.Expr.terms {
+			used[t.symbol] = true
+		}
+	}
+	for i := range d {
+		if !used[i] {
+			v := clamp(0, d[i])
+			d[i] = interval{v, v}
+		}
+	}
+	return s.search(d)
+}
+
+// bounds returns the interval of e over the domains, propagating the
+// constraints first, ok is false if they can't be satisfied
+func bounds(domains []interval, constraints []Constraint, e Expr) (lo, hi int, ok bool) {
+	s := &solver{constraints: constraints}
+	d := append([]interval(nil), domains...)
+	if !s.propagate(d) {
+		return 0, 0, false
+	}
+	lo, hi = exprBounds(d, e, -1)
+	return lo, hi, true
+}
+
+func (s *solver) search(d []interval) ([]int, bool, error) {
+	s.nodes++
+	if s.nodes > maxNodes {
+		return nil, false, ErrGaveUp
+	}
+	if !s.propagate(d) {
+		return nil, false, nil
+	}
+
+	split := -1
+	for i, domain := range d {
+		if domain.min < domain.max && (split < 0 || domain.max-domain.min < d[split].max-d[split].min) {
+			split = i
+		}
+	}
+	if split < 0 {
+		values := make([]int, len(d))
+		for i, domain := range d {
+			values[i] = domain.min
+		}
+		for _, c := range s.constraints {
+			if !c.holds(values) {
+				return nil, false, nil
+			}
+		}
+		return values, true, nil
+	}
+
+	// lower values first, like a search counting up
+	mid := d[split].min + (d[split].max-d[split].min)/2
+	for _, half := range []interval{{d[split].min, mid}, {mid + 1, d[split].max}} {
+		sub := append([]interval(nil), d...)
+		sub[split] = half
+		values, found, err := s.search(sub)
+		if found || err != nil {
+			return values, found, err
+		}
+	}
+	return nil, false, nil
+}
+
+// propagate narrows the domains until no constraint narrows them anymore
+// it returns false if a constraint can't be satisfied
+func (s *solver) propagate(d []interval) bool {
+	for changed := true; changed; {
+		changed = false
+		for _, c := range s.constraints {
+			narrowed, ok := narrow(d, c)
+			if !ok {
+				return false
+			}
+			changed = changed || narrowed
+		}
+	}
+	return true
+}
+
+// narrow tightens the domains of the symbols of c
+func narrow(d []interval, c Constraint) (narrowed, ok bool) {
+	lo, hi := exprBounds(d, c.Expr, -1)
+	if c.Relation == NotEqual {
+		if lo == 0 && hi == 0 {
+			return false, false
+		}
+		return excludeZero(d, c.Expr), true
+	}
+
+	// the expression must be within [want.min, want.max]
+	want := interval{0, 0}
+	switch c.Relation {
+	case Less:
+		want = interval{-infinity, -1}
+	case GreaterOrEqual:
+		want = interval{0, infinity}
+	}
+	if lo > want.max || hi < want.min {
+		return false, false
+	}
+
+	for i, t := range c.Expr.terms {
+		restLo, restHi := exprBounds(d, c.Expr, i)
+		// coeff*x is within [want.min-restHi, want.max-restLo]
+		domain := d[t.symbol]
+		if restHi < infinity && want.min > -infinity {
+			if t.coeff > 0 {
+				domain.min = maxInt(domain.min, ceilDiv(want.min-restHi, t.coeff))
+			} else {
+				domain.max = minInt(domain.max, floorDiv(want.min-restHi, t.coeff))
+			}
+		}
+		if restLo > -infinity && want.max < infinity {
+			if t.coeff > 0 {
+				domain.max = minInt(domain.max, floorDiv(want.max-restLo, t.coeff))
+			} else {
+				domain.min = maxInt(domain.min, ceilDiv(want.max-restLo, t.coeff))
+			}
+		}
+		if domain.min > domain.max {
+			return narrowed, false
+		}
+		if domain != d[t.symbol] {
+			d[t.symbol] = domain
+			narrowed = true
+		}
+	}
+	return narrowed, true
+}
+
+// excludeZero removes from the domain of the last free symbol of e the value
+// making e zero, when it is a bound of the domain
+func excludeZero(d []interval, e Expr) bool {
+	free := -1
+	for i, t := range e.terms {
+		if d[t.symbol].min != d[t.symbol].max {
+			if free >= 0 {
+				return false
+			}
+			free = i
+		}
+	}
+	if free < 0 {
+		return false
+	}
+	rest, _ := exprBounds(d, e, free)
+	t := e.terms[free]
+	if rest%t.coeff != 0 {
+		return false
+	}
+	v := -rest / t.coeff
+	switch v {
+	case d[t.symbol].min:
+		d[t.symbol].min++
+	case d[t.symbol].max:
+		d[t.symbol].max--
+	default:
+		return false
+	}
+	return true
+}
+
+// exprBounds returns the interval of e over the domains, without its term skip
+// bounds beyond infinity are saturated
+func exprBounds(d []interval, e Expr, skip int) (lo, hi int) {
+	lo, hi = saturate(e.constant), saturate(e.constant)
+	for i, t := range e.terms {
+		if i == skip {
+			continue
+		}
+		a, b := mulSat(t.coeff, d[t.symbol].min), mulSat(t.coeff, d[t.symbol].max)
+		if a > b {
+			a, b = b, a
+		}
+		lo, hi = addSat(lo, a), addSat(hi, b)
+	}
+	return lo, hi
+}
+
+func addSat(a, b int) int {
+	return saturate(a + b)
+}
+
+func mulSat(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if abs(a) >= infinity/abs(b) {
+		if (a < 0) != (b < 0) {
+			return -infinity
+		}
+		return infinity
+	}
+	return a * b
+}
+
+func saturate(v int) int {
+	switch {
+	case v > infinity:
+		return infinity
+	case v < -infinity:
+		return -infinity
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) == (b < 0) {
+		q++
+	}
+	return q
+}
+
+// clamp returns the value of the domain closest to v
+func clamp(v int, domain interval) int {
+	return minInt(maxInt(v, domain.min), domain.max)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,284 @@
+package symbolic
+
+import (
+	"adventofcode2019/intcode"
+	"fmt"
+)
+
+// state is the machine following a path
+type state struct {
+	// mem holds the program, sym the cells holding symbols or written beyond it
+	mem []int
+	sym map[int]Expr
+	ip  int
+	rb  int
+
+	constraints []Constraint
+	outputs     []Expr
+	inputs      int
+	steps       int
+	// err ends the path, it is set when a fork fails
+	err error
+}
+
+func (e *Engine) initial() *state {
+	s := &state{mem: append([]int(nil), e.program...), sym: make(map[int]Expr)}
+	for address, sym := range e.memory {
+		s.sym[address] = Var(sym)
+	}
+	return s
+}
+
+// clone copies the state to follow another path
+func (s *state) clone() *state {
+	c := *s
+	c.mem = append([]int(nil), s.mem...)
+	c.sym = make(map[int]Expr, len(s.sym))
+	for address, x := range s.sym {
+		c.sym[address] = x
+	}
+	c.constraints = append([]Constraint(nil), s.constraints...)
+	c.outputs = append([]Expr(nil), s.outputs...)
+	return &c
+}
+
+func (s *state) read(address int) Expr {
+	if x, found := s.sym[address]; found {
+		return x
+	}
+	if address < len(s.mem) {
+		return Const(s.mem[address])
+	}
+	return Const(0)
+}
+
+func (s *state) write(address int, x Expr) {
+	if v, ok := x.Constant(); ok && address < len(s.mem) {
+		s.mem[address] = v
+		delete(s.sym, address)
+		return
+	}
+	s.sym[address] = x
+}
+
+func (e *Engine) unsupported(s *state, format string, args ...interface{}) error {
+	return fmt.Errorf("%w at ip %v: %v", ErrUnsupported, s.ip, fmt.Sprintf(format, args...))
+}
+
+// concrete returns the only value x can take on the path
+func (e *Engine) concrete(s *state, x Expr, what string) (int, error) {
+	if v, ok := x.Constant(); ok {
+		return v, nil
+	}
+	if known, reason := x.Known(); !known {
+		return 0, e.unsupported(s, "%v is unknown (%v)", what, reason)
+	}
+	if lo, hi, ok := bounds(e.domains(), s.constraints, x); ok && lo == hi {
+		return lo, nil
+	}
+	return 0, e.unsupported(s, "%v depends on symbols: %v", what, e.Format(x))
+}
+
+// feasible tells if some values of the symbols satisfy the constraints
+// a search which gave up counts as feasible
+func (e *Engine) feasible(constraints []Constraint) bool {
+	_, found, err := solve(e.domains(), constraints)
+	return found || err != nil
+}
+
+// branch applies the outcome of c to s, and forks a copy of s for the
+// opposite outcome when both are possible
+func (e *Engine) branch(s *state, c Constraint, apply func(s *state, holds bool) error) (*state, error) {
+	if _, ok := c.Expr.Constant(); ok {
+		return nil, apply(s, c.holds(nil))
+	}
+	if known, reason := c.Expr.Known(); !known {
+		return nil, e.unsupported(s, "condition on an unknown value (%v)", reason)
+	}
+
+	opposite := c.negate()
+	holds := e.feasible(append(s.constraints[:len(s.constraints):len(s.constraints)], c))
+	fails := e.feasible(append(s.constraints[:len(s.constraints):len(s.constraints)], opposite))
+	switch {
+	case holds && fails:
+		fork := s.clone()
+		fork.constraints = append(fork.constraints, opposite)
+		fork.err = apply(fork, false)
+		s.constraints = append(s.constraints, c)
+		return fork, apply(s, true)
+	case holds:
+		return nil, apply(s, true)
+	case fails:
+		return nil, apply(s, false)
+	}
+	return nil, e.unsupported(s, "no feasible branch for %v", e.FormatConstraint(c))
+}
+
+// step executes the instruction at the instruction pointer
+// it returns the state following the other branch when the instruction forks
+func (e *Engine) step(s *state) (fork *state, halted bool, err error) {
+	s.steps++
+	if e.MaxSteps > 0 && s.steps > e.MaxSteps {
+		return nil, false, fmt.Errorf("%w: %v instructions executed, at ip %v", intcode.ErrInstructionLimit, e.MaxSteps, s.ip)
+	}
+	if s.ip < 0 {
+		return nil, false, &intcode.Fault{Kind: intcode.NegativeAddress, IP: s.ip, Address: s.ip}
+	}
+	code, err := e.concrete(s, s.read(s.ip), "instruction")
+	if err != nil {
+		return nil, false, err
+	}
+	fault := func(kind intcode.FaultKind, param, mode, address int) error {
+		return &intcode.Fault{Kind: kind, IP: s.ip, Instruction: code, Opcode: code % 100, Param: param, Mode: mode, Address: address}
+	}
+
+	// address returns the address of parameter i, from 0, ok is false in immediate mode
+	address := func(i int) (x Expr, ok bool, err error) {
+		mode := code / []int{100, 1000, 10000}[i] % 10
+		raw := s.read(s.ip + 1 + i)
+		switch mode {
+		case 0:
+			return raw, true, nil
+		case 1:
+			return raw, false, nil
+		case 2:
+			return raw.Add(Const(s.rb)), true, nil
+		}
+		return Expr{}, false, fault(intcode.InvalidMode, i+1, mode, 0)
+	}
+	param := func(i int) (Expr, error) {
+		x, ok, err := address(i)
+		if err != nil || !ok {
+			return x, err
+		}
+		if _, constant := x.Constant(); !constant {
+			a, err := e.concrete(s, x, "address")
+			if err != nil {
+				// the value is only needed if it is used
+				return unknownExpr("read of mem[%v] at ip %v", e.Format(x), s.ip), nil
+			}
+			x = Const(a)
+		}
+		a, _ := x.Constant()
+		if a < 0 {
+			return Expr{}, fault(intcode.NegativeAddress, i+1, 0, a)
+		}
+		return s.read(a), nil
+	}
+	dest := func(i int) (int, error) {
+		x, ok, err := address(i)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fault(intcode.ImmediateDestination, i+1, 1, 0)
+		}
+		a, err := e.concrete(s, x, "destination address")
+		if err == nil && a < 0 {
+			err = fault(intcode.NegativeAddress, i+1, 0, a)
+		}
+		return a, err
+	}
+	params := func(n int) ([]Expr, error) {
+		values := make([]Expr, n)
+		for i := range values {
+			v, err := param(i)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	switch code % 100 {
+	case 1, 2:
+		args, err := params(2)
+		if err != nil {
+			return nil, false, err
+		}
+		d, err := dest(2)
+		if err != nil {
+			return nil, false, err
+		}
+		if code%100 == 1 {
+			s.write(d, args[0].Add(args[1]))
+		} else {
+			s.write(d, args[0].Mul(args[1]))
+		}
+		s.ip += 4
+	case 3:
+		d, err := dest(0)
+		if err != nil {
+			return nil, false, err
+		}
+		s.write(d, Var(e.Input(s.inputs)))
+		s.inputs++
+		s.ip += 2
+	case 4:
+		args, err := params(1)
+		if err != nil {
+			return nil, false, err
+		}
+		s.outputs = append(s.outputs, args[0])
+		s.ip += 2
+	case 5, 6:
+		args, err := params(2)
+		if err != nil {
+			return nil, false, err
+		}
+		c := Constraint{Expr: args[0], Relation: NotEqual}
+		if code%100 == 6 {
+			c.Relation = Equal
+		}
+		fork, err := e.branch(s, c, func(s *state, jump bool) error {
+			if !jump {
+				s.ip += 3
+				return nil
+			}
+			target, err := e.concrete(s, args[1], "jump target")
+			s.ip = target
+			return err
+		})
+		return fork, false, err
+	case 7, 8:
+		args, err := params(2)
+		if err != nil {
+			return nil, false, err
+		}
+		d, err := dest(2)
+		if err != nil {
+			return nil, false, err
+		}
+		c := Lt(args[0], args[1])
+		if code%100 == 8 {
+			c = Eq(args[0], args[1])
+		}
+		fork, err := e.branch(s, c, func(s *state, holds bool) error {
+			if holds {
+				s.write(d, Const(1))
+			} else {
+				s.write(d, Const(0))
+			}
+			s.ip += 4
+			return nil
+		})
+		return fork, false, err
+	case 9:
+		args, err := params(1)
+		if err != nil {
+			return nil, false, err
+		}
+		offset, err := e.concrete(s, args[0], "relative base offset")
+		if err != nil {
+			return nil, false, err
+		}
+		s.rb += offset
+		s.ip += 2
+	case 99:
+		return nil, true, nil
+	default:
+		return nil, false, fault(intcode.UnknownOpcode, 0, 0, 0)
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,236 @@
+package intcode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// TraceEntry describes an executed instruction
+type TraceEntry struct {
+	Step   int `json:"step"`
+	IP     int `json:"ip"`
+	Opcode int `json:"opcode"`
+	// Modes are the raw mode digits of the instruction (instruction / 100)
+	Modes int `json:"modes"`
+	// Operands are the resolved values of the parameters read
+	Operands []int `json:"operands"`
+	// Dest is the address written by the instruction, -1 if none
+	Dest int `json:"dest"`
+	// Value is the value written at Dest
+	Value int `json:"value"`
+	// RelativeBase is the relative base before execution
+	RelativeBase int `json:"rb"`
+}
+
+// TraceEncoder writes trace entries
+type TraceEncoder interface {
+	Encode(e TraceEntry) error
+}
+
+// Tracer records the instructions executed by a Program
+type Tracer struct {
+	Encoder TraceEncoder
+	// when To > From, only instructions with From <= ip < To are recorded
+	From, To int
+	// when not empty, only these opcodes are recorded
+	Opcodes map[int]bool
+	// when positive, recording stops after MaxEntries entries
+	MaxEntries int
+
+	steps    int
+	recorded int
+}
+
+// NewTracer creates a tracer recording everything with enc
+func NewTracer(enc TraceEncoder) *Tracer {
+	return &Tracer{Encoder: enc}
+}
+
+// Recorded is the number of entries encoded so far
+func (t *Tracer) Recorded() int {
+	return t.recorded
+}
+
+// SetTracer attaches a tracer to the program, nil detaches it
+func (p *Program) SetTracer(t *Tracer) {
+	p.tracer = t
+}
+
+// before prepares the entry of the instruction about to be executed
+// it returns nil if the instruction is filtered out
+func (t *Tracer) before(p *Program) *TraceEntry {
+	if t.MaxEntries > 0 && t.recorded >= t.MaxEntries {
+		return nil
+	}
+	ip := p.instrPtr
+	if t.To > t.From && (ip < t.From || ip >= t.To) {
+		return nil
+	}
+	inst, err := p.InstructionAt(ip)
+	if err != nil {
+		// the execution will report it
+		return nil
+	}
+	if len(t.Opcodes) > 0 && !t.Opcodes[inst.Opcode] {
+		return nil
+	}
+
+	entry := &TraceEntry{
+		Step:         t.steps,
+		IP:           ip,
+		Opcode:       inst.Opcode,
+		Modes:        p.MemoryAt(ip) / 100,
+		Operands:     make([]int, 0, len(inst.Params)),
+		Dest:         -1,
+		RelativeBase: p.relativeBase,
+	}
+	write := inst.info().write
+	for i, param := range inst.Params {
+		switch {
+		case i == write:
+			entry.Dest = param
+			if inst.Modes[i] == relativeMode {
+				entry.Dest += p.relativeBase
+			}
+		case inst.Modes[i] == immediateMode:
+			entry.Operands = append(entry.Operands, param)
+		default:
+			address := param
+			if inst.Modes[i] == relativeMode {
+				address += p.relativeBase
+			}
+			if address < 0 {
+				// the execution will report the fault
+				return nil
+			}
+			entry.Operands = append(entry.Operands, p.MemoryAt(address))
+		}
+	}
+	return entry
+}
+
+// after counts the instruction once it is executed, and encodes its entry
+// if it was not filtered out, so failed and retried instructions count once
+func (t *Tracer) after(p *Program, entry *TraceEntry) error {
+	t.steps++
+	if entry == nil {
+		return nil
+	}
+	if entry.Dest >= 0 {
+		entry.Value = p.MemoryAt(entry.Dest)
+	}
+	t.recorded++
+	return t.Encoder.Encode(*entry)
+}
+
+type jsonTraceEncoder struct {
+	enc *json.Encoder
+}
+
+// NewJSONTraceEncoder writes entries as JSON Lines
+func NewJSONTraceEncoder(w io.Writer) TraceEncoder {
+	return &jsonTraceEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonTraceEncoder) Encode(entry TraceEntry) error {
+	return e.enc.Encode(entry)
+}
+
+// binaryTraceMagic starts every binary trace
+const binaryTraceMagic = "ICT1"
+
+type binaryTraceEncoder struct {
+	w      io.Writer
+	header bool
+	buf    []byte
+}
+
+// NewBinaryTraceEncoder writes entries as a sequence of varints:
+// step, ip, opcode, modes, number of operands, operands, dest, value, rb
+func NewBinaryTraceEncoder(w io.Writer) TraceEncoder {
+	return &binaryTraceEncoder{w: w}
+}
+
+func (e *binaryTraceEncoder) Encode(entry TraceEntry) error {
+	e.buf = e.buf[:0]
+	if !e.header {
+		e.buf = append(e.buf, binaryTraceMagic...)
+		e.header = true
+	}
+
+	values := []int{entry.Step, entry.IP, entry.Opcode, entry.Modes, len(entry.Operands)}
+	values = append(values, entry.Operands...)
+	values = append(values, entry.Dest, entry.Value, entry.RelativeBase)
+
+	var tmp [binary.MaxVarintLen64]byte
+	for _, v := range values {
+		n := binary.PutVarint(tmp[:], int64(v))
+		e.buf = append(e.buf, tmp[:n]...)
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// BinaryTraceDecoder reads a trace written by a binary trace encoder
+type BinaryTraceDecoder struct {
+	r      *bufio.Reader
+	header bool
+}
+
+// NewBinaryTraceDecoder creates a decoder reading from r
+func NewBinaryTraceDecoder(r io.Reader) *BinaryTraceDecoder {
+	return &BinaryTraceDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next entry, it returns io.EOF at the end of the trace
+func (d *BinaryTraceDecoder) Decode() (TraceEntry, error) {
+	var entry TraceEntry
+	if !d.header {
+		magic := make([]byte, len(binaryTraceMagic))
+		if _, err := io.ReadFull(d.r, magic); err != nil {
+			return entry, err
+		}
+		if string(magic) != binaryTraceMagic {
+			return entry, errors.New("not a binary intcode trace")
+		}
+		d.header = true
+	}
+
+	first, err := binary.ReadVarint(d.r)
+	if err != nil {
+		// io.EOF is expected before a new entry
+		return entry, err
+	}
+
+	// once an error happens, next reads are ignored
+	read := func() int {
+		if err != nil {
+			return 0
+		}
+		v, readErr := binary.ReadVarint(d.r)
+		if readErr != nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return int(v)
+	}
+
+	entry.Step = int(first)
+	entry.IP = read()
+	entry.Opcode = read()
+	entry.Modes = read()
+	operands := read()
+	if operands < 0 || operands > 3 {
+		return entry, errors.New("corrupted binary intcode trace")
+	}
+	entry.Operands = make([]int, operands)
+	for i := range entry.Operands {
+		entry.Operands[i] = read()
+	}
+	entry.Dest = read()
+	entry.Value = read()
+	entry.RelativeBase = read()
+	return entry, err
+}
@@ -0,0 +1,113 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// sliceEncoder collects trace entries
+type sliceEncoder struct {
+	entries []TraceEntry
+}
+
+func (e *sliceEncoder) Encode(entry TraceEntry) error {
+	e.entries = append(e.entries, entry)
+	return nil
+}
+
+// traceProgram adds 2 and 3 into address 7, outputs 5 and halts
+var traceProgram = []int{1101, 2, 3, 7, 104, 5, 99, 0}
+
+func runTraced(t *testing.T, tracer *Tracer) {
+	p := ProgramCreator(traceProgram)()
+	p.SetTracer(tracer)
+	in, out, quit := make(chan int), make(chan int, 1), make(chan int, 1)
+	if err := p.Run(in, out, quit); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTraceFilters(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		tracer *Tracer
+		steps  []int
+	}{
+		{"all", &Tracer{}, []int{0, 1, 2}},
+		{"opcodes", &Tracer{Opcodes: map[int]bool{4: true}}, []int{1}},
+		{"range", &Tracer{From: 4, To: 7}, []int{1, 2}},
+		{"max entries", &Tracer{MaxEntries: 2}, []int{0, 1}},
+	} {
+		enc := &sliceEncoder{}
+		test.tracer.Encoder = enc
+		runTraced(t, test.tracer)
+
+		if len(enc.entries) != len(test.steps) {
+			t.Fatalf("%v: got %v entries, want %v", test.name, len(enc.entries), len(test.steps))
+		}
+		for i, entry := range enc.entries {
+			if entry.Step != test.steps[i] {
+				t.Errorf("%v: entry %v: got step %v, want %v", test.name, i, entry.Step, test.steps[i])
+			}
+		}
+	}
+}
+
+func TestBinaryTraceRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	runTraced(t, NewTracer(NewBinaryTraceEncoder(&b)))
+
+	d := NewBinaryTraceDecoder(&b)
+	entry, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Opcode != 1 || entry.Dest != 7 || entry.Value != 5 || len(entry.Operands) != 2 {
+		t.Errorf("got %+v, want an add of 2 and 3 into 7", entry)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.Decode(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestTraceNegativeOperand(t *testing.T) {
+	p := ProgramCreator([]int{1, -1, 0, 0, 99})()
+	p.SetTracer(NewTracer(&sliceEncoder{}))
+
+	err := p.RunIO(nil, nil, nil)
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Kind != NegativeAddress {
+		t.Fatalf("got %v, want a negative address fault", err)
+	}
+}
+
+func TestTraceRetriedInput(t *testing.T) {
+	enc := &sliceEncoder{}
+	p := ProgramCreator([]int{3, 9, 4, 9, 99})()
+	p.SetTracer(NewTracer(enc))
+
+	if err := p.RunIO(nil, nil, nil); err != ErrNoInput {
+		t.Fatalf("got %v, want ErrNoInput", err)
+	}
+	p.Feed(42)
+	if err := p.RunIO(nil, nil, &SliceOutput{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{3, 4, 99}
+	if len(enc.entries) != len(want) {
+		t.Fatalf("got %v entries, want %v", len(enc.entries), len(want))
+	}
+	for i, entry := range enc.entries {
+		if entry.Step != i || entry.Opcode != want[i] {
+			t.Errorf("entry %v: got step %v opcode %v, want step %v opcode %v", i, entry.Step, entry.Opcode, i, want[i])
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package intcode
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+)
+
+// Transpile writes a Go source file, in package pkg, executing the program in memory
+//
+// The generated Program has a method per basic block found by BuildCFG.
+// Opcodes and modes are compiled in, operands are still read from memory so
+// patching them, like day02 does with noun and verb, is supported.
+// The execution goes on in the intcode interpreter when an opcode cell is
+// written or when a jump goes to an address which is not a known block.
+func Transpile(w io.Writer, memory []int, pkg string) error {
+	cfg := BuildCFG(memory)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, transpiledHeader, pkg, intSlice(memory), intSlice(opcodeCells(cfg)))
+
+	fmt.Fprintln(&buf, "// dispatch runs the block starting at ip, it returns false if there is none")
+	fmt.Fprintln(&buf, "func (p *Program) dispatch() (bool, error) {")
+	fmt.Fprintln(&buf, "switch p.ip {")
+	for _, b := range cfg.Blocks {
+		fmt.Fprintf(&buf, "case %d:\nreturn true, p.block%04d()\n", b.Start, b.Start)
+	}
+	fmt.Fprintln(&buf, "}")
+	fmt.Fprintln(&buf, "return false, nil")
+	fmt.Fprintln(&buf, "}")
+
+	for _, b := range cfg.Blocks {
+		writeBlock(&buf, b)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// opcodeCells lists the addresses holding the opcode of a translated instruction
+func opcodeCells(cfg *CFG) []int {
+	var cells []int
+	for _, b := range cfg.Blocks {
+		for _, inst := range b.Instructions {
+			cells = append(cells, inst.Address)
+		}
+	}
+	return cells
+}
+
+// writeBlock writes the method executing the block
+func writeBlock(buf *bytes.Buffer, b *Block) {
+	fmt.Fprintf(buf, "\nfunc (p *Program) block%04d() error {\n", b.Start)
+	for _, inst := range b.Instructions {
+		fmt.Fprintf(buf, "// %04d: %v\n", inst.Address, inst)
+		writeInstruction(buf, inst)
+	}
+	if b.Instructions[len(b.Instructions)-1].Opcode == 99 {
+		fmt.Fprintln(buf, "}")
+		return
+	}
+	// reached when the last instruction does not jump
+	fmt.Fprintf(buf, "p.ip = %d\nreturn nil\n}\n", b.End)
+}
+
+// writeInstruction writes the statements executing inst
+func writeInstruction(buf *bytes.Buffer, inst Instruction) {
+	info := inst.info()
+	next := inst.Address + inst.Len()
+
+	// addresses of the parameters not in immediate mode
+	var checks []string
+	values := make([]string, len(inst.Params))
+	fmt.Fprintln(buf, "{")
+	for i, mode := range inst.Modes {
+		cell := fmt.Sprintf("p.at(%d)", inst.Address+i+1)
+		switch mode {
+		case immediateMode:
+			values[i] = cell
+			continue
+		case relativeMode:
+			fmt.Fprintf(buf, "a%d := p.rb + %v\n", i, cell)
+		default:
+			fmt.Fprintf(buf, "a%d := %v\n", i, cell)
+		}
+		checks = append(checks, fmt.Sprintf("a%d < 0", i))
+		values[i] = fmt.Sprintf("p.at(a%d)", i)
+	}
+	if len(checks) > 0 {
+		// the interpreter reports the fault
+		fmt.Fprintf(buf, "if %v {\np.ip = %d\nreturn errFallback\n}\n", strings.Join(checks, " || "), inst.Address)
+	}
+
+	set := func(value string) {
+		fmt.Fprintf(buf, "if p.set(a%d, %v) {\np.ip = %d\nreturn nil\n}\n", info.write, value, next)
+	}
+	switch inst.Opcode {
+	case 1:
+		set(values[0] + " + " + values[1])
+	case 2:
+		set(values[0] + " * " + values[1])
+	case 3:
+		fmt.Fprintf(buf, "v, err := p.read()\nif err != nil {\np.ip = %d\nreturn err\n}\n", inst.Address)
+		set("v")
+	case 4:
+		fmt.Fprintf(buf, "if err := p.write(%v); err != nil {\np.ip = %d\nreturn err\n}\n", values[0], inst.Address)
+	case 5:
+		fmt.Fprintf(buf, "if %v != 0 {\np.ip = %v\nreturn nil\n}\n", values[0], values[1])
+	case 6:
+		fmt.Fprintf(buf, "if %v == 0 {\np.ip = %v\nreturn nil\n}\n", values[0], values[1])
+	case 7:
+		fmt.Fprintf(buf, "v := 0\nif %v < %v {\nv = 1\n}\n", values[0], values[1])
+		set("v")
+	case 8:
+		fmt.Fprintf(buf, "v := 0\nif %v == %v {\nv = 1\n}\n", values[0], values[1])
+		set("v")
+	case 9:
+		fmt.Fprintf(buf, "p.rb += %v\n", values[0])
+	case 99:
+		fmt.Fprintf(buf, "p.ip = %d\np.halted = true\nreturn nil\n", inst.Address)
+	}
+	fmt.Fprintln(buf, "}")
+}
+
+func intSlice(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+const transpiledHeader = `// Code generated by the intcode transpiler. DO NOT EDIT.
+
+package %v
+
+import (
+	"adventofcode2019/intcode"
+	"context"
+	"errors"
+)
+
+var initialMemory = []int{%v}
+
+// opcodeCells are the addresses of the translated instructions
+var opcodeCells = []int{%v}
+
+// errFallback asks to go on with the interpreter
+var errFallback = errors.New("fallback to the interpreter")
+
+// maxDenseMemory is the size above which memory is stored in a map
+const maxDenseMemory = 1 << 20
+
+// Program is the translated intcode program
+type Program struct {
+	memory []int
+	extra  map[int]int
+	code   []bool
+	ip, rb int
+	halted bool
+	// modified is set once an opcode cell is written
+	modified bool
+	in       intcode.Input
+	out      intcode.Output
+	// values written when there is no output
+	pendingOutput []int
+	// vm executes the program once translated code can't be trusted
+	vm *intcode.Program
+}
+
+// New creates an instance of the program
+func New() *Program {
+	p := &Program{
+		memory: make([]int, len(initialMemory)),
+		code:   make([]bool, len(initialMemory)),
+	}
+	copy(p.memory, initialMemory)
+	for _, address := range opcodeCells {
+		p.code[address] = true
+	}
+	return p
+}
+
+// MemoryAt returns the value at a specific address, 0 for a negative address
+func (p *Program) MemoryAt(address int) int {
+	if p.vm != nil {
+		return p.vm.MemoryAt(address)
+	}
+	if address < 0 {
+		return 0
+	}
+	return p.at(address)
+}
+
+// SetMemory allows to set a value at address
+func (p *Program) SetMemory(address, v int) {
+	if p.vm != nil {
+		p.vm.SetMemory(address, v)
+		return
+	}
+	p.set(address, v)
+}
+
+// Run executes the program
+func (p *Program) Run(in, out, quit chan int) error {
+	err := p.RunIO(nil, intcode.ChanInput(in), intcode.ChanOutput(out))
+	if err != nil {
+		return err
+	}
+	close(out)
+	quit <- 0
+	return nil
+}
+
+// RunIO executes the program with in and out until it halts, fails or ctx is done
+// ctx may be nil if the execution can't be cancelled
+func (p *Program) RunIO(ctx context.Context, in intcode.Input, out intcode.Output) error {
+	if p.vm != nil {
+		return p.vm.RunIO(ctx, in, out)
+	}
+	p.in, p.out = in, out
+
+	for len(p.pendingOutput) > 0 && p.out != nil {
+		if err := p.out.Write(p.pendingOutput[0]); err != nil {
+			return err
+		}
+		p.pendingOutput = p.pendingOutput[1:]
+	}
+
+	for blocks := 0; !p.halted; blocks++ {
+		if ctx != nil && blocks%%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if p.modified {
+			return p.interpret(ctx)
+		}
+		found, err := p.dispatch()
+		if !found || err == errFallback {
+			return p.interpret(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpret goes on with the intcode interpreter from the current state
+func (p *Program) interpret(ctx context.Context) error {
+	s := &intcode.Snapshot{
+		Program:       p.memory[:len(initialMemory)],
+		InstrPtr:      p.ip,
+		RelativeBase:  p.rb,
+		Halted:        p.halted,
+		PendingOutput: p.pendingOutput,
+	}
+	if len(p.memory) > len(initialMemory) || len(p.extra) > 0 {
+		s.ExtraMemory = make(map[int]int)
+		for address := len(initialMemory); address < len(p.memory); address++ {
+			if p.memory[address] != 0 {
+				s.ExtraMemory[address] = p.memory[address]
+			}
+		}
+		for address, v := range p.extra {
+			s.ExtraMemory[address] = v
+		}
+	}
+	p.vm = s.Restore()
+	return p.vm.RunIO(ctx, p.in, p.out)
+}
+
+func (p *Program) at(address int) int {
+	if address < len(p.memory) {
+		return p.memory[address]
+	}
+	return p.extra[address]
+}
+
+// set writes v at address and informs if an opcode cell was written
+func (p *Program) set(address, v int) bool {
+	switch {
+	case address < len(p.memory):
+		p.memory[address] = v
+	case address < maxDenseMemory:
+		size := 2 * len(p.memory)
+		if size <= address {
+			size = address + 1
+		}
+		if size > maxDenseMemory {
+			size = maxDenseMemory
+		}
+		p.memory = append(p.memory, make([]int, size-len(p.memory))...)
+		p.memory[address] = v
+	default:
+		if p.extra == nil {
+			p.extra = make(map[int]int)
+		}
+		p.extra[address] = v
+	}
+	if address < len(p.code) && p.code[address] {
+		p.modified = true
+		return true
+	}
+	return false
+}
+
+func (p *Program) read() (int, error) {
+	if p.in == nil {
+		return 0, intcode.ErrNoInput
+	}
+	return p.in.Read()
+}
+
+func (p *Program) write(v int) error {
+	if p.out == nil {
+		p.pendingOutput = append(p.pendingOutput, v)
+		return nil
+	}
+	return p.out.Write(v)
+}
+
+`
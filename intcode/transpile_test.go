@@ -0,0 +1,114 @@
+package intcode
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// transpiledMain runs every transpiled package with its inputs and prints the outputs
+const transpiledMain = `package main
+
+import (
+	"adventofcode2019/intcode"
+	"fmt"
+%v)
+
+func main() {
+%v}
+
+func print(err error, out *intcode.SliceOutput) {
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(out.Values)
+}
+`
+
+func TestTranspile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the transpiled programs are built with the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	countdown, err := Assemble(strings.NewReader(loopSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day05, err := ReadProgram("../day05/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		program []int
+		inputs  []int
+	}{
+		{"quine", []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}, nil},
+		{"countdown", countdown, []int{10}},
+		{"compare", day05, []int{7}},
+		// the second output instruction is replaced by a halt, the interpreter goes on
+		{"self-modifying", []int{1101, 0, 99, 6, 104, 7, 104, 8, 99}, nil},
+		// a jump out of the known blocks
+		{"computed jump", []int{1101, 0, 9, 20, 5, 20, 20, 99, 99, 104, 5, 99}, nil},
+	}
+
+	// the generated packages import intcode so they are built in the module,
+	// the go command ignores directories starting with _ in ./... patterns
+	dir, err := os.MkdirTemp(".", "_transpiled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Base(dir)
+
+	var imports, calls strings.Builder
+	for i, test := range tests {
+		pkg := fmt.Sprintf("p%v", i)
+		if err := os.Mkdir(filepath.Join(dir, pkg), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(filepath.Join(dir, pkg, "program.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Transpile(f, test.program, pkg)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		fmt.Fprintf(&imports, "\t\"adventofcode2019/intcode/%v/%v\"\n", dir, pkg)
+		fmt.Fprintf(&calls, "\t{\n\t\tout := &intcode.SliceOutput{}\n\t\terr := %v.New().RunIO(nil, intcode.SliceInput(%v), out)\n\t\tprint(err, out)\n\t}\n", pkg, intSlice(test.inputs))
+	}
+	main := fmt.Sprintf(transpiledMain, imports.String(), calls.String())
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := exec.Command(goCmd, "run", "./"+dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("got %v lines, want %v:\n%s", len(lines), len(tests), output)
+	}
+	for i, test := range tests {
+		out := &SliceOutput{}
+		err := ProgramCreator(test.program)().RunIO(nil, SliceInput(test.inputs...), out)
+		want := fmt.Sprint(out.Values)
+		if err != nil {
+			want = err.Error()
+		}
+		if lines[i] != want {
+			t.Errorf("%v: got %v, want %v like the interpreter", test.name, lines[i], want)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"adventofcode2019/common"
+	"adventofcode2019/intcode"
+	"adventofcode2019/intcode/dap"
+	"adventofcode2019/intcode/symbolic"
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// disassemble prints the annotated listing of the program in filepath
+func disassemble(filepath string) error {
+	seq, err := intcode.ReadProgram(filepath)
+	if err != nil {
+		return err
+	}
+	return intcode.Disassemble(seq).WriteListing(os.Stdout)
+}
+
+// assemble prints the program assembled from the source in filepath
+func assemble(filepath string) error {
+	f := common.OpenFile(filepath)
+	defer common.CloseFile(f)
+
+	seq, err := intcode.Assemble(f)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filepath, err)
+	}
+
+	parts := make([]string, len(seq))
+	for i, v := range seq {
+		parts[i] = strconv.Itoa(v)
+	}
+	fmt.Println(strings.Join(parts, ","))
+	return nil
+}
+
+// debug runs the program in filepath in the interactive debugger
+func debug(filepath string) error {
+	seq, err := intcode.ReadProgram(filepath)
+	if err != nil {
+		return err
+	}
+	p := intcode.ProgramCreator(seq)()
+	return intcode.NewDebugger(p, os.Stdin, os.Stdout).Run()
+}
+
+// debugAttached attaches the interactive debugger to every intcode program created,
+// the days keep driving their programs
+func debugAttached() {
+	intcode.Instrument(intcode.NewAttachedDebugger(os.Stdin, os.Stdout).Attach)
+}
+
+// toolFlushes are the functions flushing the files of the intcode tools
+var toolFlushes struct {
+	sync.Mutex
+	funcs []func() error
+}
+
+// addToolFlush registers a function flushing the files of an intcode tool
+func addToolFlush(flush func() error) {
+	toolFlushes.Lock()
+	defer toolFlushes.Unlock()
+	toolFlushes.funcs = append(toolFlushes.funcs, flush)
+}
+
+// flushTools runs the registered flushes once, the last registered first,
+// and returns the first error
+func flushTools() error {
+	toolFlushes.Lock()
+	funcs := toolFlushes.funcs
+	toolFlushes.funcs = nil
+	toolFlushes.Unlock()
+
+	var first error
+	for i := len(funcs) - 1; i >= 0; i-- {
+		if err := funcs[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// checkError flushes the intcode tools and logs a Fatal if error not nil,
+// log.Fatal skips deferred functions so a failing run would lose its traces
+func checkError(err error) {
+	if err != nil {
+		if flushErr := flushTools(); flushErr != nil {
+			log.Print(flushErr)
+		}
+		common.CheckError(err)
+	}
+}
+
+// toolFile returns the file written by a tool for the nth program created, from 0:
+// path for the first one, then path.1, path.2...
+// it returns false once maxFiles are written, a day may create thousands of programs
+func toolFile(path string, n, maxFiles int) (string, bool) {
+	if maxFiles > 0 && n >= maxFiles {
+		if n == maxFiles {
+			fmt.Fprintf(os.Stderr, "%v: only the first %v intcode programs are written\n", path, maxFiles)
+		}
+		return "", false
+	}
+	if n == 0 {
+		return path, true
+	}
+	return fmt.Sprintf("%v.%v", path, n), true
+}
+
+// traceIntcode attaches a tracer to the first maxFiles intcode programs created
+// the first program writes to path, the next ones to path.1, path.2...
+// it returns a function flushing all traces
+func traceIntcode(path, format string, max int, ops, ips string, maxFiles int) (func() error, error) {
+	newEncoder := intcode.NewJSONTraceEncoder
+	switch format {
+	case "json":
+	case "binary":
+		newEncoder = intcode.NewBinaryTraceEncoder
+	default:
+		return nil, fmt.Errorf("unknown trace format %q", format)
+	}
+
+	opcodes := make(map[int]bool)
+	if ops != "" {
+		for _, op := range strings.Split(ops, ",") {
+			code, err := strconv.Atoi(op)
+			if err != nil {
+				return nil, err
+			}
+			opcodes[code] = true
+		}
+	}
+
+	from, to := 0, 0
+	if ips != "" {
+		bounds := strings.Split(ips, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid address range %q", ips)
+		}
+		var err error
+		if from, err = strconv.Atoi(bounds[0]); err != nil {
+			return nil, err
+		}
+		if to, err = strconv.Atoi(bounds[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	// programs may be created from several goroutines
+	var mu sync.Mutex
+	var writers []*bufio.Writer
+	var files []*os.File
+	created := 0
+	intcode.Instrument(func(p *intcode.Program) {
+		// the lock is not held while exiting, the flush takes it
+		mu.Lock()
+		filepath, ok := toolFile(path, created, maxFiles)
+		created++
+		mu.Unlock()
+		if !ok {
+			return
+		}
+		f, err := os.Create(filepath)
+		checkError(err)
+		w := bufio.NewWriter(f)
+		mu.Lock()
+		files = append(files, f)
+		writers = append(writers, w)
+		mu.Unlock()
+
+		t := intcode.NewTracer(newEncoder(io.Writer(w)))
+		t.Opcodes = opcodes
+		t.From, t.To = from, to
+		t.MaxEntries = max
+		p.SetTracer(t)
+	})
+
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, w := range writers {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if err := files[i].Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// profileIntcode attaches a profiler to every intcode program created
+// it returns a function writing the merged profile of all programs in path
+func profileIntcode(path, format string, top int) (func() error, error) {
+	if format != "text" && format != "pprof" {
+		return nil, fmt.Errorf("unknown profile format %q", format)
+	}
+
+	var mu sync.Mutex
+	var profilers []*intcode.Profiler
+	intcode.Instrument(func(p *intcode.Program) {
+		pr := intcode.NewProfiler()
+		mu.Lock()
+		profilers = append(profilers, pr)
+		mu.Unlock()
+		p.SetProfiler(pr)
+	})
+
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		merged := intcode.NewProfiler()
+		for _, pr := range profilers {
+			merged.Merge(pr)
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if format == "pprof" {
+			err = merged.WritePprof(f)
+		} else {
+			err = merged.WriteReport(f, top)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+// heatmapIntcode attaches a heat map to the first maxFiles intcode programs created
+// it is redrawn on stdout every live instructions if live is positive
+// it returns a function writing the PNG of the first program to path, if set,
+// the next ones to path.1, path.2...
+func heatmapIntcode(path string, live, width, scale, maxFiles int) func() error {
+	var mu sync.Mutex
+	var heatmaps []*intcode.HeatMap
+	name := path
+	if name == "" {
+		name = "heat map"
+	}
+	created := 0
+	intcode.Instrument(func(p *intcode.Program) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := toolFile(name, created, maxFiles)
+		created++
+		if !ok {
+			return
+		}
+		h := intcode.NewHeatMap()
+		h.Width = width
+		if live > 0 {
+			h.Live, h.Every = os.Stdout, live
+		}
+		heatmaps = append(heatmaps, h)
+		p.SetHeatMap(h)
+	})
+
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, h := range heatmaps {
+			if live > 0 {
+				if err := h.Render(os.Stdout); err != nil {
+					return err
+				}
+			}
+			if path == "" {
+				continue
+			}
+			filepath, _ := toolFile(path, i, maxFiles)
+			f, err := os.Create(filepath)
+			if err != nil {
+				return err
+			}
+			if err := h.WritePNG(f, scale); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// debugIntcode serves a Debug Adapter Protocol client on a TCP address, or on
+// stdin and stdout if address is stdio, and attaches every intcode program created
+// it returns once the client has set its breakpoints, with a function ending the session
+func debugIntcode(address string) (func() error, error) {
+	var session *dap.Session
+	if address == "stdio" {
+		session = dap.NewSession(os.Stdin, os.Stdout)
+		// the protocol owns stdout, what the days print goes to stderr
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+	} else {
+		fmt.Fprintf(os.Stderr, "waiting for a DAP client on %v\n", address)
+		var err error
+		session, err = dap.Listen(address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go func() {
+		if err := session.Serve(); err != nil {
+			fmt.Fprintf(os.Stderr, "dap: %v\n", err)
+		}
+	}()
+	<-session.Configured()
+	intcode.Instrument(session.Attach)
+	return session.Close, nil
+}
+
+// recordIntcode attaches a recorder to the first maxFiles intcode programs created
+// the first program writes to path, the next ones to path.1, path.2...
+// files are not buffered so a failing run keeps its recordings
+// it returns a function closing all files
+func recordIntcode(path string, maxFiles int) func() error {
+	var mu sync.Mutex
+	var files []*os.File
+	created := 0
+	intcode.Instrument(func(p *intcode.Program) {
+		// the lock is not held while exiting, the close takes it
+		mu.Lock()
+		filepath, ok := toolFile(path, created, maxFiles)
+		created++
+		mu.Unlock()
+		if !ok {
+			return
+		}
+		f, err := os.Create(filepath)
+		checkError(err)
+		mu.Lock()
+		files = append(files, f)
+		mu.Unlock()
+		p.SetRecorder(intcode.NewRecorder(f))
+	})
+
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, f := range files {
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// replay runs the program recorded in filepath and prints its outputs
+// it fails at the first output differing from the recording
+func replay(filepath string) error {
+	f := common.OpenFile(filepath)
+	defer common.CloseFile(f)
+
+	rec, err := intcode.ReadRecording(f)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filepath, err)
+	}
+
+	if err := rec.Replay(nil, printOutput{}); err != nil {
+		return err
+	}
+	fmt.Printf("Replayed %v events\n", len(rec.Events))
+	return nil
+}
+
+// solve finds values of the symbols making the program in filepath reach goal
+// symbols are memory cells with their range, the inputs are symbols too
+func solve(filepath, goal, symbols, inputs string) error {
+	seq, err := intcode.ReadProgram(filepath)
+	if err != nil {
+		return err
+	}
+
+	target, want, err := parseGoal(goal)
+	if err != nil {
+		return err
+	}
+	engine := symbolic.New(seq)
+	if inputs != "" {
+		if engine.InputMin, engine.InputMax, err = parseRange(inputs); err != nil {
+			return err
+		}
+	}
+	if symbols != "" {
+		for _, symbol := range strings.Split(symbols, ",") {
+			parts := strings.SplitN(symbol, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid symbol %q, expected address=min..max", symbol)
+			}
+			address, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return err
+			}
+			min, max, err := parseRange(parts[1])
+			if err != nil {
+				return err
+			}
+			engine.Memory(address, min, max)
+		}
+	}
+
+	solution, err := engine.Solve(target, want)
+	if err != nil {
+		return err
+	}
+	x, _ := target(solution.Path)
+	fmt.Printf("%v with %v\n", strings.SplitN(goal, "=", 2)[0], engine.Format(x))
+	for _, c := range solution.Path.Constraints {
+		fmt.Printf("  if %v\n", engine.FormatConstraint(c))
+	}
+	fmt.Println("Solution:", solution)
+	return nil
+}
+
+// parseGoal parses a goal like mem[0]=19690720, out=42 for the last output or out[0]=42
+func parseGoal(goal string) (symbolic.Target, int, error) {
+	parts := strings.SplitN(goal, "=", 2)
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("invalid goal %q, expected mem[x]=v, out=v or out[x]=v", goal)
+	}
+	want, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	name := parts[0]
+	if name == "out" {
+		return symbolic.OutputTarget(-1), want, nil
+	}
+	for _, prefix := range []string{"mem[", "out["} {
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, "]") {
+			n, err := strconv.Atoi(name[len(prefix) : len(name)-1])
+			if err != nil {
+				return nil, 0, err
+			}
+			if prefix == "mem[" {
+				return symbolic.MemoryTarget(n), want, nil
+			}
+			return symbolic.OutputTarget(n), want, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("invalid goal %q, expected mem[x]=v, out=v or out[x]=v", goal)
+}
+
+// parseRange parses a range like 0..99, bounds included
+func parseRange(s string) (int, int, error) {
+	bounds := strings.Split(s, "..")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, expected min..max", s)
+	}
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := strconv.Atoi(bounds[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("empty range %q", s)
+	}
+	return min, max, nil
+}
+
+// printOutput prints the values written by a program, large or not
+type printOutput struct{}
+
+func (printOutput) Write(v int) error {
+	fmt.Println(v)
+	return nil
+}
+
+func (printOutput) WriteBig(v *big.Int) error {
+	fmt.Println(v)
+	return nil
+}
+
+// setArithmetic makes every intcode program created use the arithmetic named name
+func setArithmetic(name string) error {
+	a, ok := intcode.ParseArithmetic(name)
+	if !ok {
+		return fmt.Errorf("unknown arithmetic %q, expected wrapping, checked or big", name)
+	}
+	intcode.Instrument(intcode.WithArithmetic(a))
+	return nil
+}
+
+// transpile writes the Go translation of the program in filepath to out
+func transpile(filepath, out, pkg string) error {
+	seq, err := intcode.ReadProgram(filepath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := intcode.Transpile(f, seq, pkg); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeCFG writes the control-flow graph of the program in filepath to out
+func writeCFG(filepath, out, format string) error {
+	seq, err := intcode.ReadProgram(filepath)
+	if err != nil {
+		return err
+	}
+	cfg := intcode.BuildCFG(seq)
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "dot":
+		err = cfg.WriteDOT(f)
+	case "json":
+		err = cfg.WriteJSON(f)
+	default:
+		err = fmt.Errorf("unknown graph format %q", format)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}